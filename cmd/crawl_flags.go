@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal"
+	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal/logger"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// addCrawlFlags adds the flags shared by the commands reading an export file and visiting its links.
+func addCrawlFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("file", "f", "", "Path to the export file (required)")
+	err := cmd.MarkFlagRequired("file")
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	cmd.Flags().StringP("output", "o", "./exported/", "Directory to save the Obsidian markdown files")
+	cmd.Flags().StringP("source", "s", "", fmt.Sprintf("Format of the export file, detected from its content when not set (%s)", strings.Join(internal.SourceNames(), ", ")))
+	cmd.Flags().String("path-template", internal.DefaultPathTemplate, "Template of the paths of the notes in the output directory, using the Title, Name, Slug, Domain, Year, Month, Day, Tag, Status and Favorite fields")
+	cmd.Flags().Bool("status-folders", false, "Place the notes in a folder named after the status of their link, such as clippings/unread, instead of using the path template")
+	cmd.Flags().String("frontmatter-template", "", "Path to a template of the properties of the notes, replacing the built-in one")
+	cmd.Flags().String("body-template", "", "Path to a template of the content of the notes, replacing the built-in one")
+	cmd.Flags().String("tag-map", "", "Path to a YAML file renaming, merging, dropping or prefixing the tags of the links")
+	cmd.Flags().String("markdown-flavor", string(internal.FlavorGFM), "Flavor of the Markdown of the notes: gfm, with tables, strikethrough, task lists and autolinks, or commonmark")
+	cmd.Flags().Bool("full-page", false, "Convert the whole page of the links, instead of only the main content extracted from it")
+	cmd.Flags().Bool("download-images", false, "Download the images of the articles as attachments of the notes")
+	cmd.Flags().String("attachments-folder", internal.DefaultAttachmentsFolder, "Folder of the output directory where images are downloaded")
+	cmd.Flags().String("image-links", string(internal.ImageLinkEmbed), "How notes link to downloaded images: embed, as Obsidian embeds, or relative, as Markdown images")
+	cmd.Flags().String("on-conflict", string(internal.ConflictMerge), "What to do when a note already exists: skip, overwrite, merge (keeping changes made outside of the clipped content) or rename")
+	cmd.Flags().IntP("concurrency", "c", internal.DefaultConcurrency, "Maximum number of links visited at the same time, 0 for no limit")
+	cmd.Flags().Int("host-concurrency", internal.DefaultHostConcurrency, "Maximum number of links of the same host visited at the same time, 0 for no limit")
+	cmd.Flags().Float64("rate", 0, "Maximum number of requests per second to each host, 0 for no limit")
+	cmd.Flags().Duration("random-delay", 0, "Maximum random delay added before each request, such as 500ms")
+	cmd.Flags().StringToString("domain-rate", nil, "Maximum number of requests per second to the hosts of a domain, such as medium.com=0.5")
+	cmd.Flags().StringToString("domain-delay", nil, "Maximum random delay added before each request to the hosts of a domain, such as medium.com=2s")
+	defaultRetryPolicy := internal.DefaultRetryPolicy()
+	cmd.Flags().Int("retries", defaultRetryPolicy.MaxAttempts-1, "Maximum number of times a link is retried after a timeout, dropped connection or retriable status")
+	cmd.Flags().Duration("retry-delay", defaultRetryPolicy.BaseDelay, "Delay before the first retry of a link, doubled for each following retry")
+	cmd.Flags().Duration("retry-max-delay", defaultRetryPolicy.MaxDelay, "Maximum delay between two attempts at a link")
+	cmd.Flags().IntSlice("retry-status", defaultRetryPolicy.RetryStatuses, "HTTP status codes for which a link is retried")
+	cmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
+}
+
+// crawlContext returns the context of the command with a logger attached, logging at the debug level
+// when the verbose flag is set.
+func crawlContext(cmd *cobra.Command) context.Context {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	var logLevel string
+	if verbose {
+		logLevel = "debug"
+	} else {
+		logLevel = "fatal"
+	}
+
+	l := logger.Get(logLevel)
+	return logger.Attach(cmd.Context(), l)
+}
+
+// crawlSource returns the source named by the source flag, or nil to detect it from the export file.
+func crawlSource(cmd *cobra.Command) (internal.Source, error) {
+	sourceName := cmd.Flag("source").Value.String()
+	if sourceName == "" {
+		return nil, nil
+	}
+	return internal.SourceByName(sourceName)
+}
+
+// crawlerOptions builds the crawler options from the note template, tag mapping, attachment, conflict, concurrency, rate limit and retry flags.
+func crawlerOptions(cmd *cobra.Command) ([]internal.CrawlerOption, error) {
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+	if err != nil {
+		return nil, err
+	}
+	hostConcurrency, err := cmd.Flags().GetInt("host-concurrency")
+	if err != nil {
+		return nil, err
+	}
+
+	retryPolicy, err := retryPolicy(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	onConflict, err := internal.ParseConflictStrategy(cmd.Flag("on-conflict").Value.String())
+	if err != nil {
+		return nil, err
+	}
+
+	pathTemplateText := cmd.Flag("path-template").Value.String()
+	if statusFolders, _ := cmd.Flags().GetBool("status-folders"); statusFolders {
+		if cmd.Flags().Changed("path-template") {
+			return nil, fmt.Errorf("--status-folders cannot be used with --path-template, use {{.Status}} in the template instead")
+		}
+		pathTemplateText = internal.StatusPathTemplate
+	}
+
+	pathTemplate, err := internal.ParsePathTemplate(pathTemplateText)
+	if err != nil {
+		return nil, err
+	}
+
+	noteTemplates, err := internal.ParseNoteTemplates(cmd.Flag("frontmatter-template").Value.String(), cmd.Flag("body-template").Value.String())
+	if err != nil {
+		return nil, err
+	}
+
+	rateOptions, err := rateLimitOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	flavor, err := internal.ParseMarkdownFlavor(cmd.Flag("markdown-flavor").Value.String())
+	if err != nil {
+		return nil, err
+	}
+
+	fullPage, err := cmd.Flags().GetBool("full-page")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []internal.CrawlerOption{
+		internal.WithConcurrency(concurrency),
+		internal.WithHostConcurrency(hostConcurrency),
+		internal.WithRetryPolicy(retryPolicy),
+		internal.WithConflictStrategy(onConflict),
+		internal.WithPathTemplate(pathTemplate),
+		internal.WithNoteTemplates(noteTemplates),
+		internal.WithMarkdownFlavor(flavor),
+		internal.WithFullPage(fullPage),
+	}
+
+	if tagMap := cmd.Flag("tag-map").Value.String(); tagMap != "" {
+		tagMapping, err := internal.ReadTagMapping(tagMap)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, internal.WithTagMapping(tagMapping))
+	}
+
+	if downloadImages, _ := cmd.Flags().GetBool("download-images"); downloadImages {
+		imageLinks, err := internal.ParseImageLinkStyle(cmd.Flag("image-links").Value.String())
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, internal.WithAttachments(cmd.Flag("attachments-folder").Value.String(), imageLinks))
+	}
+
+	return append(opts, rateOptions...), nil
+}
+
+// rateLimitOptions builds the crawler options setting the global and per domain rate limits from the flags.
+// Domains with only a rate or only a delay set use the global value for the other one.
+func rateLimitOptions(cmd *cobra.Command) ([]internal.CrawlerOption, error) {
+	rate, err := cmd.Flags().GetFloat64("rate")
+	if err != nil {
+		return nil, err
+	}
+	randomDelay, err := cmd.Flags().GetDuration("random-delay")
+	if err != nil {
+		return nil, err
+	}
+	domainRates, err := cmd.Flags().GetStringToString("domain-rate")
+	if err != nil {
+		return nil, err
+	}
+	domainDelays, err := cmd.Flags().GetStringToString("domain-delay")
+	if err != nil {
+		return nil, err
+	}
+
+	global := internal.RateLimit{RequestsPerSecond: rate, RandomDelay: randomDelay}
+	domains := make(map[string]internal.RateLimit)
+	for domain, value := range domainRates {
+		limit, ok := domains[domain]
+		if !ok {
+			limit = global
+		}
+		if limit.RequestsPerSecond, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("invalid rate %s for domain %s: %w", value, domain, err)
+		}
+		domains[domain] = limit
+	}
+	for domain, value := range domainDelays {
+		limit, ok := domains[domain]
+		if !ok {
+			limit = global
+		}
+		if limit.RandomDelay, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid delay %s for domain %s: %w", value, domain, err)
+		}
+		domains[domain] = limit
+	}
+
+	opts := []internal.CrawlerOption{internal.WithRateLimit(global)}
+	for domain, limit := range domains {
+		opts = append(opts, internal.WithDomainRateLimit(domain, limit))
+	}
+	return opts, nil
+}
+
+// retryPolicy builds the retry policy of the crawler from the flags.
+func retryPolicy(cmd *cobra.Command) (internal.RetryPolicy, error) {
+	policy := internal.DefaultRetryPolicy()
+
+	retries, err := cmd.Flags().GetInt("retries")
+	if err != nil {
+		return policy, err
+	}
+	if retries < 0 {
+		return policy, fmt.Errorf("the number of retries must not be negative, got %d", retries)
+	}
+	policy.MaxAttempts = retries + 1
+
+	if policy.BaseDelay, err = cmd.Flags().GetDuration("retry-delay"); err != nil {
+		return policy, err
+	}
+	if policy.MaxDelay, err = cmd.Flags().GetDuration("retry-max-delay"); err != nil {
+		return policy, err
+	}
+	if policy.RetryStatuses, err = cmd.Flags().GetIntSlice("retry-status"); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
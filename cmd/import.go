@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal"
-	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal/logger"
 
 	"github.com/spf13/cobra"
 )
@@ -23,19 +22,40 @@ attempt to scrape and include the article's content in the markdown file.`,
 			return
 		}
 
-		verbose, err := cmd.Flags().GetBool("verbose")
+		ctx := crawlContext(cmd)
 
-		var logLevel string
-		if verbose {
-			logLevel = "debug"
-		} else {
-			logLevel = "fatal"
+		source, err := crawlSource(cmd)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		crawlerOptions, err := crawlerOptions(cmd)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
 		}
 
-		l := logger.Get(logLevel)
-		ctx := logger.Attach(cmd.Context(), l)
+		resume, err := cmd.Flags().GetBool("resume")
+		if err != nil {
+			fmt.Printf("Error getting resume: %v\n", err)
+			return
+		}
 
-		crawler, err := internal.NewPocketCrawler(outputDir)
+		journal, err := internal.OpenJournal(outputDir, resume)
+		if err != nil {
+			fmt.Printf("Error opening journal: %v\n", err)
+			return
+		}
+		defer func(journal *internal.Journal) {
+			_ = journal.Close()
+		}(journal)
+
+		if resume {
+			fmt.Printf("Resuming import, %d links already visited\n", journal.Len())
+		}
+
+		crawler, err := internal.NewPocketCrawler(outputDir, append(crawlerOptions, internal.WithJournal(journal))...)
 		if err != nil {
 			fmt.Printf("Error creating Pocket crawler: %v\n", err)
 			return
@@ -43,7 +63,7 @@ attempt to scrape and include the article's content in the markdown file.`,
 
 		fmt.Println(fmt.Sprintf("Importing links from Pocket export file %s...", importFile))
 
-		results, err := crawler.ImportLinks(ctx, importFile)
+		results, err := crawler.ImportLinks(ctx, source, importFile)
 		if err != nil {
 			fmt.Printf("Error importing links: %v\n", err)
 			return
@@ -58,6 +78,11 @@ attempt to scrape and include the article's content in the markdown file.`,
 			fmt.Printf("Error writing results: %v\n", err)
 		}
 
+		if ctx.Err() != nil {
+			fmt.Println("Import interrupted, run it again with the --resume flag to continue where it stopped")
+			return
+		}
+
 		fmt.Println(fmt.Sprintf("All links visited and markdown files created at %s", outputDir))
 	},
 }
@@ -65,12 +90,6 @@ attempt to scrape and include the article's content in the markdown file.`,
 func init() {
 	rootCmd.AddCommand(importCmd)
 
-	importCmd.Flags().StringP("file", "f", "", "Path to the Pocket export file (required)")
-	err := importCmd.MarkFlagRequired("file")
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	importCmd.Flags().StringP("output", "o", "./exported/", "Directory to save the Obsidian markdown files")
-	importCmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
+	addCrawlFlags(importCmd)
+	importCmd.Flags().Bool("resume", false, "Resume a previous import into the output directory, skipping the links it already wrote")
 }
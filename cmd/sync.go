@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal"
+
+	"github.com/spf13/cobra"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Syncs a new export file with the notes of a previous import",
+	Long: `Given a new export file and the directory of a previous import, this command will only visit the links
+that have no note yet and create their markdown files. Existing notes, matched by the source URL in their properties,
+are not overwritten, but have their tags updated to match the export.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		importFile := cmd.Flag("file").Value.String()
+		outputDir := cmd.Flag("output").Value.String()
+		if importFile == "" {
+			fmt.Println("Error: The --file flag is required")
+			return
+		}
+
+		ctx := crawlContext(cmd)
+
+		source, err := crawlSource(cmd)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		crawlerOptions, err := crawlerOptions(cmd)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		crawler, err := internal.NewPocketCrawler(outputDir, crawlerOptions...)
+		if err != nil {
+			fmt.Printf("Error creating Pocket crawler: %v\n", err)
+			return
+		}
+
+		fmt.Println(fmt.Sprintf("Syncing links from export file %s with %s...", importFile, outputDir))
+
+		report, err := crawler.SyncLinks(ctx, source, importFile)
+		if err != nil {
+			fmt.Printf("Error syncing links: %v\n", err)
+			return
+		}
+
+		resultsWriter, err := internal.NewResultsWriter(fmt.Sprintf("%s/failed.csv", outputDir))
+		if err != nil {
+			fmt.Printf("Error initializing results writer: %v\n", err)
+		}
+
+		if err := resultsWriter.WriteResults(report.Results); err != nil {
+			fmt.Printf("Error writing results: %v\n", err)
+		}
+
+		fmt.Println("Added notes:", report.Added)
+		fmt.Println("Updated notes:", report.Updated)
+		fmt.Println("Unchanged notes:", report.Unchanged)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	addCrawlFlags(syncCmd)
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Highlight is a passage of an article that was highlighted in Pocket.
+type Highlight struct {
+	Quote     string    `json:"quote"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// rawAnnotation is a single item of the annotations JSON files in a Pocket export.
+type rawAnnotation struct {
+	URL        string         `json:"url"`
+	Title      string         `json:"title"`
+	Highlights []rawHighlight `json:"highlights"`
+}
+
+type rawHighlight struct {
+	Quote     string `json:"quote"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (r rawHighlight) toHighlight() Highlight {
+	return Highlight{
+		Quote:     r.Quote,
+		CreatedAt: time.Unix(r.CreatedAt, 0),
+	}
+}
+
+// isAnnotationsPart reports whether the archive entry is one of the annotation JSON files of the export.
+func isAnnotationsPart(file *zip.File) bool {
+	if file.FileInfo().IsDir() {
+		return false
+	}
+	return strings.HasPrefix(file.Name, "annotations/") && strings.EqualFold(path.Ext(file.Name), ".json")
+}
+
+// readAnnotations decodes the highlights in an annotations file, keyed by the URL of the article.
+func readAnnotations(r io.Reader, name string) (map[string][]Highlight, error) {
+	var annotations []rawAnnotation
+	if err := json.NewDecoder(r).Decode(&annotations); err != nil {
+		return nil, fmt.Errorf("error decoding annotations file %s: %w", name, err)
+	}
+
+	highlights := make(map[string][]Highlight)
+	for _, annotation := range annotations {
+		for _, highlight := range annotation.Highlights {
+			if strings.TrimSpace(highlight.Quote) == "" {
+				continue
+			}
+			highlights[annotation.URL] = append(highlights[annotation.URL], highlight.toHighlight())
+		}
+	}
+
+	return highlights, nil
+}
+
+// renderHighlights renders the highlights as a Markdown section of Obsidian quote callouts,
+// titled with the time each highlight was made.
+func renderHighlights(highlights []Highlight) string {
+	if len(highlights) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## Highlights\n\n")
+	for i, highlight := range highlights {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("> [!quote] %s\n", highlight.CreatedAt.Format("2006-01-02 15:04")))
+		for _, line := range strings.Split(strings.TrimSpace(highlight.Quote), "\n") {
+			sb.WriteString(strings.TrimRight(fmt.Sprintf("> %s", line), " "))
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
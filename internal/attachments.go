@@ -0,0 +1,269 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal/logger"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImageLinkStyle decides how notes link to the images downloaded as attachments.
+type ImageLinkStyle string
+
+const (
+	// ImageLinkEmbed links images with Obsidian embeds, such as ![[3f2a9c0b1d4e5f60.png]].
+	ImageLinkEmbed ImageLinkStyle = "embed"
+	// ImageLinkRelative links images with Markdown images, by their path relative to the note.
+	ImageLinkRelative ImageLinkStyle = "relative"
+)
+
+// ImageLinkStyles lists the available image link styles.
+var ImageLinkStyles = []ImageLinkStyle{ImageLinkEmbed, ImageLinkRelative}
+
+// ParseImageLinkStyle returns the image link style with the given name.
+func ParseImageLinkStyle(name string) (ImageLinkStyle, error) {
+	for _, style := range ImageLinkStyles {
+		if string(style) == name {
+			return style, nil
+		}
+	}
+	return "", fmt.Errorf("unknown image link style %s, expected one of: embed, relative", name)
+}
+
+// DefaultAttachmentsFolder is the folder of the output directory where images are downloaded.
+const DefaultAttachmentsFolder = "attachments"
+
+const (
+	// maxAttachmentSize is the maximum size in bytes of a downloaded image. Larger images are left remote.
+	maxAttachmentSize = 25 << 20
+	// attachmentScheme marks the images of a page replaced by a downloaded attachment, until the path of
+	// its note is known and the image can be linked from it.
+	attachmentScheme = "attachment:"
+)
+
+// attachmentImage matches the Markdown images pointing to an attachment, capturing their alt text and file name.
+var attachmentImage = regexp.MustCompile(`!\[((?:\\.|[^\]\\])*)\]\(` + attachmentScheme + `([^)\s]+)\)`)
+
+// imageExtensions maps the content types of common images to the extension of their files.
+var imageExtensions = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/avif":    ".avif",
+	"image/svg+xml": ".svg",
+	"image/bmp":     ".bmp",
+	"image/tiff":    ".tiff",
+	"image/x-icon":  ".ico",
+}
+
+// AttachmentStore downloads the images of the pages into the attachments folder of the output directory.
+// Images are named after a hash of their content, so an image used by several notes is only stored once.
+type AttachmentStore struct {
+	folder string
+	style  ImageLinkStyle
+	rates  *rateLimiter
+	client *http.Client
+
+	mu    sync.Mutex
+	files map[string]string
+}
+
+// NewAttachmentStore initializes an AttachmentStore saving images in the given folder of the base folder,
+// and waiting for the rate limits of the hosts before downloading them.
+func NewAttachmentStore(baseFolder string, folder string, style ImageLinkStyle, rates *rateLimiter) (*AttachmentStore, error) {
+	absPath := filepath.Join(baseFolder, filepath.FromSlash(folder))
+	if err := os.MkdirAll(absPath, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating attachments folder %s: %w", folder, err)
+	}
+
+	return &AttachmentStore{
+		folder: absPath,
+		style:  style,
+		rates:  rates,
+		client: &http.Client{Timeout: 30 * time.Second},
+		files:  make(map[string]string),
+	}, nil
+}
+
+// DownloadImages downloads the images of the page, resolving their URLs against the base URL of the page,
+// and points them to their attachment. Images that cannot be downloaded keep their remote URL.
+func (s *AttachmentStore) DownloadImages(ctx context.Context, page *goquery.Selection, base *url.URL) {
+	log := logger.Logger(ctx)
+
+	for _, img := range page.Find("img").EachIter() {
+		src := imageSource(img)
+		if src == "" {
+			continue
+		}
+		imageURL, err := base.Parse(src)
+		if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") {
+			continue
+		}
+
+		name, err := s.download(ctx, imageURL.String())
+		if err != nil {
+			log.Warn("Error downloading image", zap.String("url", base.String()), zap.String("image", imageURL.String()), zap.Error(err))
+			continue
+		}
+		img.SetAttr("src", attachmentScheme+name)
+		img.RemoveAttr("srcset")
+	}
+}
+
+// imageSource returns the URL of the image, preferring the source of lazy-loaded images over their placeholder.
+func imageSource(img *goquery.Selection) string {
+	src := strings.TrimSpace(img.AttrOr("src", ""))
+	if lazy := strings.TrimSpace(img.AttrOr("data-src", "")); lazy != "" && (src == "" || strings.HasPrefix(src, "data:")) {
+		return lazy
+	}
+	return src
+}
+
+// download saves the image at the given URL as an attachment, unless it was already downloaded, and
+// returns the name of its file.
+func (s *AttachmentStore) download(ctx context.Context, imageURL string) (string, error) {
+	s.mu.Lock()
+	name, ok := s.files[imageURL]
+	s.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	if err := s.rates.Wait(ctx, hostOf(imageURL)); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	ext, err := imageExtension(resp.Header.Get("Content-Type"), imageURL)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxAttachmentSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(content) > maxAttachmentSize {
+		return "", fmt.Errorf("image larger than %d bytes", maxAttachmentSize)
+	}
+
+	hash := sha256.Sum256(content)
+	name = hex.EncodeToString(hash[:])[:16] + ext
+	if err := s.save(name, content); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.files[imageURL] = name
+	s.mu.Unlock()
+	return name, nil
+}
+
+// imageExtension returns the extension of the files of images with the given content type, falling back
+// to the extension of their URL for servers that do not tell the type of their images.
+func imageExtension(contentType string, imageURL string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if ext, ok := imageExtensions[mediaType]; ok {
+		return ext, nil
+	}
+	if mediaType != "" && mediaType != "application/octet-stream" {
+		return "", fmt.Errorf("not an image: %s", mediaType)
+	}
+
+	if u, err := url.Parse(imageURL); err == nil {
+		ext := strings.ToLower(path.Ext(u.Path))
+		for _, known := range imageExtensions {
+			if ext == known || (ext == ".jpeg" && known == ".jpg") {
+				return known, nil
+			}
+		}
+	}
+	return "", errors.New("unknown image type")
+}
+
+// save writes the attachment with the given name, unless a file already holds it. The file is written
+// under a temporary name first, so notes never link to a partially written image.
+func (s *AttachmentStore) save(name string, content []byte) error {
+	fileName := filepath.Join(s.folder, name)
+	if _, err := os.Stat(fileName); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(s.folder, ".download-*")
+	if err != nil {
+		return fmt.Errorf("error creating file in %s: %w", s.folder, err)
+	}
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing to file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing to file %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		return fmt.Errorf("error writing to file %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// LinkImages rewrites the images of the Markdown content pointing to an attachment into links to its file
+// from the note at the given path, in the link style of the store.
+func (s *AttachmentStore) LinkImages(content string, noteFile string) string {
+	if s == nil {
+		return content
+	}
+
+	return attachmentImage.ReplaceAllStringFunc(content, func(image string) string {
+		match := attachmentImage.FindStringSubmatch(image)
+		alt, name := match[1], match[2]
+		if s.style == ImageLinkEmbed {
+			return fmt.Sprintf("![[%s]]", name)
+		}
+
+		rel, err := filepath.Rel(filepath.Dir(noteFile), filepath.Join(s.folder, name))
+		if err != nil {
+			return image
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.ContainsAny(rel, " ()") {
+			rel = "<" + rel + ">"
+		}
+		return fmt.Sprintf("![%s](%s)", alt, rel)
+	})
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// codeGutterCells and codeGutterNumbers select the line numbers that syntax highlighters render next to
+// code: the table cells of Pygments, Rouge, highlight.js and GitHub, and the inline numbers of Pygments,
+// Prism and others.
+const (
+	codeGutterCells   = "td.linenos, td.gl, td.rouge-gutter, td.gutter, td.hljs-ln-numbers, td.blob-num, td.line-numbers, td.lineno"
+	codeGutterNumbers = "pre .lineno, pre .linenos, pre .ln, pre .line-numbers-rows, pre .react-code-line-number, " +
+		"code .lineno, code .linenos, code .ln, code .line-numbers-rows"
+)
+
+// codeLanguageClasses match the class names holding the language of code: language-go and lang-go, used by
+// Prism, highlight.js and most Markdown renderers, highlight-go and highlight-source-go, used by Sphinx and
+// GitHub, and brush: go, used by SyntaxHighlighter.
+var codeLanguageClasses = regexp.MustCompile(`^(?:language-|lang-|highlight-source-|highlight-|brush:)([a-z0-9+#._-]*)$`)
+
+// codeLanguageName matches the names of languages.
+var codeLanguageName = regexp.MustCompile(`^[a-z0-9][a-z0-9+#._-]*$`)
+
+// notCodeLanguages are the class names found next to the language of code that are not languages, along
+// with the names highlighters give to code without a language.
+var notCodeLanguages = map[string]bool{
+	"hljs": true, "chroma": true, "highlight": true, "sourcecode": true, "notranslate": true, "prettyprint": true,
+	"linenums": true, "line-numbers": true, "code": true, "block": true, "wrap": true, "copy": true,
+	"text": true, "plaintext": true, "plain": true, "none": true, "nohighlight": true, "no-highlight": true,
+}
+
+// codeBlocksPlugin prepares the code blocks of pages for their conversion to fenced code blocks: it removes
+// their line numbers and marks them with the language found in the hints of syntax highlighters.
+type codeBlocksPlugin struct{}
+
+func (p *codeBlocksPlugin) Name() string {
+	return "code-blocks"
+}
+
+func (p *codeBlocksPlugin) Init(conv *converter.Converter) error {
+	conv.Register.PreRenderer(p.handlePreRender, converter.PriorityEarly)
+	return nil
+}
+
+func (p *codeBlocksPlugin) handlePreRender(_ converter.Context, doc *html.Node) {
+	page := goquery.NewDocumentFromNode(doc).Selection
+
+	// Tables of line numbers and code become a single code block once their gutter is removed
+	gutters := page.Find(codeGutterCells)
+	tables := gutters.Closest("table")
+	gutters.Remove()
+	for _, table := range tables.EachIter() {
+		flattenCodeTable(table)
+	}
+	page.Find(codeGutterNumbers).Remove()
+
+	for _, pre := range page.Find("pre").EachIter() {
+		if language := codeLanguage(pre); language != "" {
+			pre.SetAttr("class", "language-"+language)
+			pre.ChildrenFiltered("code").SetAttr("class", "language-"+language)
+		}
+	}
+}
+
+// flattenCodeTable replaces a table of code, left with its code cells, with a code block. Tables holding a
+// code block, such as those of Pygments and Rouge, are replaced with it, while tables with a row per line,
+// such as those of highlight.js and GitHub, are joined into one.
+func flattenCodeTable(table *goquery.Selection) {
+	if pre := table.Find("pre"); pre.Length() > 0 {
+		// Keep the language hints of the wrapper on the code block
+		if language := codeLanguage(table); language != "" {
+			pre.First().SetAttr("data-lang", language)
+		}
+		table.ReplaceWithSelection(pre.First())
+		return
+	}
+
+	lines := make([]string, 0)
+	for _, row := range table.Find("tr").EachIter() {
+		lines = append(lines, strings.TrimRight(row.Text(), "\n"))
+	}
+	pre := &html.Node{Type: html.ElementNode, Data: "pre"}
+	code := &html.Node{Type: html.ElementNode, Data: "code"}
+	code.AppendChild(&html.Node{Type: html.TextNode, Data: strings.Join(lines, "\n")})
+	pre.AppendChild(code)
+	if language := codeLanguage(table); language != "" {
+		pre.Attr = append(pre.Attr, html.Attribute{Key: "data-lang", Val: language})
+	}
+	table.ReplaceWithNodes(pre)
+}
+
+// codeLanguage returns the language of the code block found in the classes and data attributes of the
+// block, of its code element and of the elements wrapping it, or an empty string when none hints at it.
+func codeLanguage(block *goquery.Selection) string {
+	elements := []*goquery.Selection{block, block.ChildrenFiltered("code")}
+	for parent, depth := block.Parent(), 0; parent.Length() > 0 && depth < 3; parent, depth = parent.Parent(), depth+1 {
+		elements = append(elements, parent)
+	}
+
+	for _, element := range elements {
+		for _, attr := range []string{"data-lang", "data-language", "data-code-language"} {
+			if language := normalizeCodeLanguage(element.AttrOr(attr, "")); language != "" {
+				return language
+			}
+		}
+
+		classes := strings.Fields(strings.ToLower(element.AttrOr("class", "")))
+		for i, class := range classes {
+			// SyntaxHighlighter separates the brush from its language, as in "brush: go;"
+			if class == "brush:" && i+1 < len(classes) {
+				class += classes[i+1]
+			}
+			if match := codeLanguageClasses.FindStringSubmatch(strings.TrimSuffix(class, ";")); match != nil {
+				if language := normalizeCodeLanguage(match[1]); language != "" {
+					return language
+				}
+			}
+		}
+
+		// highlight.js and Pandoc add the language as a class next to their own
+		if hasAnyClass(classes, "hljs", "sourcecode") {
+			for _, class := range classes {
+				if language := normalizeCodeLanguage(class); language != "" && !strings.HasPrefix(language, "hljs") {
+					return language
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// normalizeCodeLanguage returns the language name in lower case, or an empty string when it is not a language.
+func normalizeCodeLanguage(language string) string {
+	language = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(language)), ";")
+	if notCodeLanguages[language] || !codeLanguageName.MatchString(language) {
+		return ""
+	}
+	return language
+}
+
+func hasAnyClass(classes []string, names ...string) bool {
+	for _, class := range classes {
+		for _, name := range names {
+			if class == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConflictStrategy decides what happens when the note of a link is written where a note already exists.
+type ConflictStrategy string
+
+const (
+	// ConflictSkip leaves the existing note untouched.
+	ConflictSkip ConflictStrategy = "skip"
+	// ConflictOverwrite replaces the existing note, losing any change made to it.
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	// ConflictMerge regenerates the properties and the clipped block of the existing note, keeping
+	// the properties and sections added to it.
+	ConflictMerge ConflictStrategy = "merge"
+	// ConflictRename writes the note next to the existing one, under a new name.
+	ConflictRename ConflictStrategy = "rename"
+)
+
+// ConflictStrategies lists the available conflict strategies.
+var ConflictStrategies = []ConflictStrategy{ConflictSkip, ConflictOverwrite, ConflictMerge, ConflictRename}
+
+// ParseConflictStrategy returns the conflict strategy with the given name.
+func ParseConflictStrategy(name string) (ConflictStrategy, error) {
+	for _, strategy := range ConflictStrategies {
+		if string(strategy) == name {
+			return strategy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown conflict strategy %s, expected one of: skip, overwrite, merge, rename", name)
+}
+
+// ErrNoteExists is returned when the note of a link is not written because a note already exists.
+var ErrNoteExists = errors.New("note already exists")
+
+// The clipped block of a note holds the content generated from the page of its link. It is delimited
+// with Obsidian comments, hidden when reading the note, so it can be regenerated without touching the
+// sections added to the note around it.
+const (
+	clippedBlockStart = "%% pocket-obsidian-migrator:clipping:start %%"
+	clippedBlockEnd   = "%% pocket-obsidian-migrator:clipping:end %%"
+)
+
+// clippedBlock returns the content of a note delimited as its clipped block.
+func clippedBlock(content string) string {
+	return fmt.Sprintf("%s\n%s\n%s\n", clippedBlockStart, strings.TrimRight(content, "\n"), clippedBlockEnd)
+}
+
+// replaceClippedBlock replaces the clipped block of the body with the clipped block of the generated body.
+// Bodies without a clipped block, written before notes had one, are returned unchanged as there is no
+// telling the clipped content apart from the changes made to it.
+func replaceClippedBlock(body string, generated string) string {
+	start, end, ok := findClippedBlock(body)
+	if !ok {
+		return body
+	}
+	generatedStart, generatedEnd, ok := findClippedBlock(generated)
+	if !ok {
+		return body
+	}
+	return body[:start] + generated[generatedStart:generatedEnd] + body[end:]
+}
+
+// findClippedBlock returns the offsets of the clipped block of the body, delimiters included.
+func findClippedBlock(body string) (int, int, bool) {
+	start := strings.Index(body, clippedBlockStart)
+	if start < 0 {
+		return 0, 0, false
+	}
+	end := strings.Index(body[start:], clippedBlockEnd)
+	if end < 0 {
+		return 0, 0, false
+	}
+	return start, start + end + len(clippedBlockEnd), true
+}
@@ -1,27 +1,148 @@
 package internal
 
 import (
+	"fmt"
+	"github.com/JohannesKaufmann/dom"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/strikethrough"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/table"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"net/url"
+	"strings"
 )
 
+// MarkdownFlavor is the flavor of the Markdown written to the notes.
+type MarkdownFlavor string
+
+const (
+	// FlavorGFM writes GitHub Flavored Markdown, with tables, strikethrough, task lists and autolinks,
+	// which Obsidian all renders, along with the Obsidian syntax for highlights, callouts, math and footnotes.
+	FlavorGFM MarkdownFlavor = "gfm"
+	// FlavorCommonMark writes strict CommonMark.
+	FlavorCommonMark MarkdownFlavor = "commonmark"
+)
+
+// MarkdownFlavors lists the available Markdown flavors.
+var MarkdownFlavors = []MarkdownFlavor{FlavorGFM, FlavorCommonMark}
+
+// ParseMarkdownFlavor returns the Markdown flavor with the given name.
+func ParseMarkdownFlavor(name string) (MarkdownFlavor, error) {
+	for _, flavor := range MarkdownFlavors {
+		if string(flavor) == name {
+			return flavor, nil
+		}
+	}
+	return "", fmt.Errorf("unknown Markdown flavor %s, expected one of: gfm, commonmark", name)
+}
+
 type MarkdownConverter struct {
 	converter *converter.Converter
 }
 
-// NewMarkdownConverter initializes a new MarkdownConverter with default options.
-func NewMarkdownConverter() *MarkdownConverter {
-	c := converter.NewConverter(converter.WithPlugins(
+// NewMarkdownConverter initializes a new MarkdownConverter writing Markdown of the given flavor.
+func NewMarkdownConverter(flavor MarkdownFlavor) *MarkdownConverter {
+	plugins := []converter.Plugin{
 		base.NewBasePlugin(),
 		commonmark.NewCommonmarkPlugin(),
-	))
+		&codeBlocksPlugin{},
+	}
+	if flavor == FlavorGFM {
+		plugins = append(plugins,
+			table.NewTablePlugin(table.WithHeaderPromotion(true)),
+			strikethrough.NewStrikethroughPlugin(),
+			&gfmPlugin{},
+			&obsidianPlugin{},
+		)
+	}
+	c := converter.NewConverter(converter.WithPlugins(plugins...))
 
 	return &MarkdownConverter{
 		converter: c,
 	}
 }
 
-func (m *MarkdownConverter) ConvertToMarkdown(htmlContent string) (string, error) {
-	return m.converter.ConvertString(htmlContent)
+// ConvertToMarkdown converts the HTML content to Markdown, rewriting its relative links and images into
+// absolute URLs resolved against the given base URL, so they still work from the vault.
+func (m *MarkdownConverter) ConvertToMarkdown(htmlContent string, baseURL string) (string, error) {
+	return m.converter.ConvertString(htmlContent, converter.WithDomain(baseURL))
+}
+
+// BaseURL returns the URL the relative URLs of the page resolve against: the href of its base element,
+// itself resolved against the URL of the page, or the URL of the page when it has none.
+func BaseURL(page *goquery.Selection, pageURL *url.URL) *url.URL {
+	href, ok := page.Find("base[href]").First().Attr("href")
+	if !ok {
+		return pageURL
+	}
+	base, err := pageURL.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return pageURL
+	}
+	return base
+}
+
+// gfmPlugin renders the GitHub Flavored Markdown extensions not covered by the table and strikethrough
+// plugins: the checkboxes of task lists and autolinks.
+type gfmPlugin struct{}
+
+func (p *gfmPlugin) Name() string {
+	return "gfm"
+}
+
+func (p *gfmPlugin) Init(conv *converter.Converter) error {
+	// The base plugin removes inputs, the checkboxes of task lists are kept by rendering them earlier
+	conv.Register.RendererFor("input", converter.TagTypeInline, p.renderCheckbox, converter.PriorityEarly)
+	conv.Register.RendererFor("a", converter.TagTypeInline, p.renderAutolink, converter.PriorityEarly)
+	return nil
+}
+
+// renderCheckbox renders the checkbox of a task list item as [ ] or [x], and drops any other input.
+func (p *gfmPlugin) renderCheckbox(_ converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	if !strings.EqualFold(dom.GetAttributeOr(n, "type", ""), "checkbox") || !isInListItem(n) {
+		return converter.RenderSuccess
+	}
+
+	if _, checked := dom.GetAttribute(n, "checked"); checked {
+		_, _ = w.WriteString("[x]")
+	} else {
+		_, _ = w.WriteString("[ ]")
+	}
+	// Separate the checkbox from the text of the item, unless the text already starts with a space
+	if next := n.NextSibling; next == nil || next.Type != html.TextNode || !strings.HasPrefix(next.Data, " ") {
+		_, _ = w.WriteString(" ")
+	}
+	return converter.RenderSuccess
+}
+
+// isInListItem reports whether the node is inside a list item, at any depth.
+func isInListItem(n *html.Node) bool {
+	for parent := n.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == html.ElementNode && parent.Data == "li" {
+			return true
+		}
+	}
+	return false
+}
+
+// renderAutolink renders the links whose text is their URL as a bare URL, which GitHub Flavored Markdown
+// and Obsidian turn into links.
+func (p *gfmPlugin) renderAutolink(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	if n.FirstChild == nil || n.FirstChild != n.LastChild || n.FirstChild.Type != html.TextNode {
+		return converter.RenderTryNext
+	}
+
+	href := strings.TrimSpace(dom.GetAttributeOr(n, "href", ""))
+	text := strings.TrimSpace(n.FirstChild.Data)
+	if text == "" || (text != href && strings.TrimSuffix(text, "/") != strings.TrimSuffix(href, "/")) {
+		return converter.RenderTryNext
+	}
+	if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+		return converter.RenderTryNext
+	}
+
+	_, _ = w.WriteString(ctx.AssembleAbsoluteURL(ctx, "a", href))
+	return converter.RenderSuccess
 }
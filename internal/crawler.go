@@ -3,10 +3,12 @@ package internal
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal/logger"
 	"github.com/gocolly/colly"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
+	"net/http"
 	"net/url"
 	"os"
 	"time"
@@ -14,111 +16,399 @@ import (
 
 type CrawlResult struct {
 	RawLink
-	Success bool   `csv:"success"`
-	Error   string `csv:"error,omitempty"`
+	Success  bool         `json:"success" csv:"success"`
+	Status   ResultStatus `json:"result" csv:"result"`
+	Error    string       `json:"error,omitempty" csv:"error,omitempty"`
+	Attempts int          `json:"attempts" csv:"attempts"`
+	File     string       `json:"file,omitempty" csv:"file"`
 }
 
 type PocketCrawler struct {
-	convertor    *MarkdownConverter
-	writer       *MarkdownWriter
-	links        *Links
-	crawlResults []CrawlResult
+	convertor       *MarkdownConverter
+	writer          *MarkdownWriter
+	links           *Links
+	concurrency     int
+	hostConcurrency int
+	rates           *rateLimiter
+	retry           RetryPolicy
+	journal         *Journal
+	fullPage        bool
+	attachments     *AttachmentStore
+
+	attachmentsFolder string
+	imageLinks        ImageLinkStyle
+}
+
+// CrawlerOption configures optional behaviour of a PocketCrawler.
+type CrawlerOption func(c *PocketCrawler)
+
+// WithConcurrency sets the maximum number of links visited at the same time, with no limit when not positive.
+func WithConcurrency(concurrency int) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.concurrency = concurrency
+	}
+}
+
+// WithHostConcurrency sets the maximum number of links of the same host visited at the same time,
+// with no limit when not positive.
+func WithHostConcurrency(concurrency int) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.hostConcurrency = concurrency
+	}
+}
+
+// WithRateLimit sets the rate limit applied to each host without a domain rate limit.
+func WithRateLimit(limit RateLimit) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.rates.global = limit
+	}
+}
+
+// WithDomainRateLimit sets the rate limit applied to the hosts of the domain and its subdomains.
+func WithDomainRateLimit(domain string, limit RateLimit) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.rates.SetDomain(domain, limit)
+	}
 }
 
-const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3"
+// WithRetryPolicy sets the policy deciding whether and when failed visits are attempted again.
+func WithRetryPolicy(policy RetryPolicy) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.retry = policy
+	}
+}
+
+// WithJournal records the result of each link in the journal, and skips the links it has already written.
+func WithJournal(journal *Journal) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.journal = journal
+	}
+}
+
+// WithConflictStrategy sets what happens when the note of a link is written where a note already exists.
+func WithConflictStrategy(strategy ConflictStrategy) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.writer.onConflict = strategy
+	}
+}
+
+// WithPathTemplate sets the template of the paths of the notes, relative to the output folder.
+func WithPathTemplate(pathTemplate *PathTemplate) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.writer.pathTemplate = pathTemplate
+	}
+}
+
+// WithNoteTemplates sets the templates rendering the frontmatter and body of the notes.
+func WithNoteTemplates(templates *NoteTemplates) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.writer.templates = templates
+	}
+}
+
+// WithTagMapping sets the mapping applied to the tags of the links before they are written to the notes.
+func WithTagMapping(mapping *TagMapping) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.writer.tagMapping = mapping
+	}
+}
+
+// WithMarkdownFlavor sets the flavor of the Markdown written to the notes.
+func WithMarkdownFlavor(flavor MarkdownFlavor) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.convertor = NewMarkdownConverter(flavor)
+	}
+}
+
+// WithFullPage converts the whole page of the links instead of only the main content extracted from it.
+func WithFullPage(fullPage bool) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.fullPage = fullPage
+	}
+}
+
+// WithAttachments downloads the images of the pages into the given folder of the output directory, and
+// links them from the notes in the given style.
+func WithAttachments(folder string, style ImageLinkStyle) CrawlerOption {
+	return func(c *PocketCrawler) {
+		c.attachmentsFolder = folder
+		c.imageLinks = style
+	}
+}
+
+const (
+	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3"
+
+	DefaultConcurrency     = 10
+	DefaultHostConcurrency = 2
+)
 
 // NewPocketCrawler initializes a new PocketCrawler.
-func NewPocketCrawler(baseFolder string) (*PocketCrawler, error) {
+func NewPocketCrawler(baseFolder string, opts ...CrawlerOption) (*PocketCrawler, error) {
 	writer, err := NewMarkdownWriter(baseFolder)
 	if err != nil {
 		return nil, err
 	}
 
-	return &PocketCrawler{
-		convertor:    NewMarkdownConverter(),
-		writer:       writer,
-		crawlResults: []CrawlResult{},
-	}, nil
+	c := &PocketCrawler{
+		convertor:       NewMarkdownConverter(FlavorGFM),
+		writer:          writer,
+		concurrency:     DefaultConcurrency,
+		hostConcurrency: DefaultHostConcurrency,
+		rates:           newRateLimiter(RateLimit{}),
+		retry:           DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.attachmentsFolder != "" {
+		c.attachments, err = NewAttachmentStore(writer.baseFolder, c.attachmentsFolder, c.imageLinks, c.rates)
+		if err != nil {
+			return nil, err
+		}
+		writer.attachments = c.attachments
+	}
+
+	return c, nil
+}
+
+// ImportLinks reads the links of the export file using the given source, or the source detected
+// from the file content when nil, and visits each of them to write its Markdown file.
+func (c *PocketCrawler) ImportLinks(ctx context.Context, source Source, linksFile string) ([]CrawlResult, error) {
+	links, err := c.loadLinks(ctx, source, linksFile)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := ScanVault(ctx, c.writer.baseFolder)
+	if err != nil {
+		return nil, err
+	}
+	c.writer.IndexNotes(notes)
+
+	return c.crawl(ctx, links.Links), nil
 }
 
-func (c *PocketCrawler) ImportLinks(ctx context.Context, linksFile string) ([]CrawlResult, error) {
+// loadLinks reads the links of the export file using the given source, or the source detected
+// from the file content when nil.
+func (c *PocketCrawler) loadLinks(ctx context.Context, source Source, linksFile string) (*Links, error) {
 	log := logger.Logger(ctx)
 
 	links := &Links{}
-	if err := links.ImportFrom(ctx, linksFile); err != nil {
+	var err error
+	if source != nil {
+		err = links.ImportFromSource(ctx, source, linksFile)
+	} else {
+		err = links.ImportFrom(ctx, linksFile)
+	}
+	if err != nil {
 		return nil, err
 	}
 	c.links = links
 
 	log.Debug("Found links", zap.Int("count", len(c.links.Links)))
 
-	if c.links == nil || len(c.links.Links) == 0 {
+	return links, nil
+}
+
+// crawl visits each of the links to write its Markdown file, and returns the result of each link in order.
+func (c *PocketCrawler) crawl(ctx context.Context, links []Link) []CrawlResult {
+	log := logger.Logger(ctx)
+
+	if len(links) == 0 {
 		log.Warn("No links to visit")
-		return nil, nil // No links to visit
+		return nil // No links to visit
 	}
 
-	g, groupCtx := errgroup.WithContext(context.Background())
+	collector := newResultCollector(links)
+
+	scheduler := newLinkScheduler(c.hostConcurrency, c.rates)
+	for i, link := range links {
+		if result, ok := c.completedResult(ctx, link); ok {
+			collector.Record(i, result)
+			continue
+		}
+		scheduler.Push(linkTask{index: i, link: link, host: hostOf(link.URL)})
+	}
+
+	workers := c.concurrency
+	if workers <= 0 || workers > len(links) {
+		workers = len(links)
+	}
 
-	for _, link := range c.links.Links {
+	// A fixed number of workers make an attempt at each link handed out by the scheduler, and report it
+	// back so the scheduler can hand out the next link of the host, and hold back the link for its retry
+	tasks := make(chan linkTask)
+	done := make(chan linkAttempt, workers)
+	g := &errgroup.Group{}
+	for range workers {
 		g.Go(func() error {
-			return c.handleLink(groupCtx, link)
+			for task := range tasks {
+				done <- c.handleLink(ctx, task, collector)
+			}
+			return nil
 		})
 	}
 
-	if err := g.Wait(); err != nil {
-		log.Error("Error visiting links", zap.Error(err))
-		return nil, err
+	var next linkTask
+	hasNext := false
+	running := 0
+schedule:
+	for {
+		var wake time.Time
+		if !hasNext {
+			next, hasNext, wake = scheduler.Next(time.Now())
+		}
+		if !hasNext && running == 0 && wake.IsZero() {
+			break
+		}
+
+		// Wait for the first link held back by a rate limit or a retry when no link can be visited
+		var send chan<- linkTask
+		var due <-chan time.Time
+		if hasNext {
+			send = tasks
+		} else if !wake.IsZero() {
+			due = time.After(time.Until(wake))
+		}
+
+		select {
+		case send <- next:
+			hasNext = false
+			running++
+		case attempt := <-done:
+			running--
+			scheduler.Done(attempt.task.host)
+			if attempt.retry {
+				scheduler.Retry(attempt.task, time.Now().Add(attempt.delay))
+			}
+		case <-due:
+		case <-ctx.Done():
+			break schedule // Links not visited are reported as canceled
+		}
+	}
+	close(tasks)
+
+	_ = g.Wait()
+	results := collector.Results()
+
+	log.Debug("Finished visiting links", zap.Int("count", len(results)))
+
+	return results
+}
+
+// completedResult returns the result recorded in the journal for the link, when it was already written.
+func (c *PocketCrawler) completedResult(ctx context.Context, link Link) (CrawlResult, bool) {
+	if c.journal == nil {
+		return CrawlResult{}, false
 	}
 
-	log.Debug("Finished visiting links", zap.Int("count", len(c.crawlResults)))
+	result, ok := c.journal.Completed(link.URL)
+	if ok {
+		logger.Logger(ctx).Debug("Skipping link already written", zap.String("url", link.URL))
+	}
+	return result, ok
+}
 
-	return c.crawlResults, nil
+// linkAttempt is an attempt made at the link of a task, which is retried after the delay when retry is set.
+type linkAttempt struct {
+	task  linkTask
+	retry bool
+	delay time.Duration
 }
 
-func (c *PocketCrawler) handleLink(ctx context.Context, link Link) error {
+// handleLink makes an attempt at visiting the link of the task. When the attempt fails with an error that
+// is retriable, and the retry policy has attempts left, it returns the delay before the link is retried.
+// Otherwise, it records the result of the import of the link.
+func (c *PocketCrawler) handleLink(ctx context.Context, task linkTask, collector *resultCollector) linkAttempt {
 	log := logger.Logger(ctx)
+	link := task.link
 
 	if ctx.Err() != nil {
-		return ctx.Err()
+		collector.Record(task.index, newCrawlResult(link, task.attempts, ctx.Err()))
+		return linkAttempt{task: task}
 	}
 
 	log.Debug("Visiting link", zap.String("url", link.URL))
 
-	err := c.visitPage(ctx, link)
-	errValue := ""
-	if err != nil {
-		errValue = err.Error()
+	task.attempts++
+	fileName, statusCode, err := c.visitPage(ctx, link)
+	if err != nil && task.attempts < c.retry.MaxAttempts && c.retry.Retriable(statusCode, err) {
+		delay := c.retry.Backoff(task.attempts)
+		log.Warn("Retrying link", zap.String("url", link.URL), zap.Int("attempt", task.attempts), zap.Duration("delay", delay), zap.Error(err))
+		return linkAttempt{task: task, retry: true, delay: delay}
 	}
-	c.crawlResults = append(c.crawlResults, CrawlResult{
-		RawLink: link.ToRawLink(),
-		Success: err == nil,
-		Error:   errValue,
-	})
 
-	return nil
+	result := newCrawlResult(link, task.attempts, err)
+	if fileName != "" {
+		result.File = c.writer.RelativePath(fileName)
+	}
+
+	if c.journal != nil && result.Status != ResultCanceled {
+		if err := c.journal.Record(result); err != nil {
+			log.Error("Error recording result in journal", zap.String("url", link.URL), zap.Error(err))
+		}
+	}
+
+	collector.Record(task.index, result)
+	return linkAttempt{task: task}
 }
 
-func (c *PocketCrawler) visitPage(ctx context.Context, link Link) error {
+// visitPage makes a single attempt at visiting the link and writing its Markdown file. It returns the
+// path of the Markdown file, the HTTP status code of a failed response, zero if no response was
+// received, and the error.
+func (c *PocketCrawler) visitPage(ctx context.Context, link Link) (string, int, error) {
+	host := hostOf(link.URL)
+
 	collector := colly.NewCollector(
 		colly.UserAgent(userAgent),
 	)
 	collector.SetRequestTimeout(30 * time.Second)
+	collector.WithTransport(contextTransport{ctx: ctx, base: http.DefaultTransport})
 
+	statusCode := 0
 	collector.OnError(func(r *colly.Response, err error) {
+		if r != nil {
+			statusCode = r.StatusCode
+		}
+		c.handleRetryAfter(ctx, r, host)
 		c.handleError(ctx, err, link)
 	})
 
+	var fileName string
+	var writeErr error
+	visited := false
 	collector.OnHTML("html", func(e *colly.HTMLElement) {
+		visited = true
 		link.ProcessMetaTags(e)
-		c.writeToFile(ctx, e, link)
+		fileName, writeErr = c.writeToFile(ctx, e, link)
 	})
 
-	err := collector.Visit(link.URL)
-	if err != nil && !IsTimeoutError(err) {
-		return err
+	if err := collector.Visit(link.URL); err != nil {
+		return "", statusCode, err
+	}
+	if !visited {
+		return "", 0, ErrNoContent
+	}
+
+	return fileName, 0, writeErr
+}
+
+// handleRetryAfter holds off the next requests to the host when it responded as overloaded or rate-limited
+// and told how long to wait for in a Retry-After header.
+func (c *PocketCrawler) handleRetryAfter(ctx context.Context, r *colly.Response, host string) {
+	if r == nil || r.Headers == nil {
+		return
+	}
+	if r.StatusCode != http.StatusTooManyRequests && r.StatusCode != http.StatusServiceUnavailable {
+		return
 	}
 
-	return nil
+	if delay, ok := parseRetryAfter(r.Headers.Get("Retry-After")); ok {
+		logger.Logger(ctx).Warn("Host asked to retry later", zap.String("host", host), zap.Duration("delay", delay))
+		c.rates.Backoff(host, delay)
+	}
 }
 
 func (c *PocketCrawler) handleError(ctx context.Context, err error, link Link) {
@@ -130,27 +420,56 @@ func (c *PocketCrawler) handleError(ctx context.Context, err error, link Link) {
 	}
 }
 
-func (c *PocketCrawler) writeToFile(ctx context.Context, e *colly.HTMLElement, link Link) {
+// writeToFile converts the main content of the page, or the whole page, to Markdown and writes its file,
+// returning its path. Errors wrap ErrConversion or ErrWrite depending on the stage that failed.
+func (c *PocketCrawler) writeToFile(ctx context.Context, e *colly.HTMLElement, link Link) (string, error) {
 	log := logger.Logger(ctx)
 
-	htmlContent, err := e.DOM.Html()
+	// Relative URLs resolve against the page after any redirect, or the base element of its head
+	baseURL := BaseURL(e.DOM, e.Request.URL)
+
+	page := e.DOM
+	if !c.fullPage {
+		page = ExtractArticle(e.DOM)
+	}
+	if c.attachments != nil {
+		c.attachments.DownloadImages(ctx, page, baseURL)
+	}
+
+	htmlContent, err := page.Html()
 	if err != nil {
 		log.Error("Error getting HTML content", zap.Error(err))
-		return
+		return "", fmt.Errorf("%w: %w", ErrConversion, err)
 	}
-	markdownContent, err := c.convertor.ConvertToMarkdown(htmlContent)
+	markdownContent, err := c.convertor.ConvertToMarkdown(htmlContent, baseURL.String())
 	if err != nil {
 		log.Error("Error converting HTML to Markdown", zap.Error(err))
-		return
+		return "", fmt.Errorf("%w: %w", ErrConversion, err)
 	}
 
 	fileName, err := c.writer.WriteMarkdownFile(link, markdownContent)
+	if errors.Is(err, ErrNoteExists) {
+		log.Debug("Skipped existing Markdown file", zap.String("url", link.URL), zap.String("fileName", fileName))
+		return fileName, err
+	}
 	if err != nil {
 		log.Error("Error writing Markdown file", zap.Error(err), zap.String("url", link.URL), zap.String("fileName", fileName))
-		return
-	} else {
-		log.Debug("Successfully wrote Markdown file", zap.String("url", link.URL), zap.String("fileName", fileName))
+		return fileName, fmt.Errorf("%w: %w", ErrWrite, err)
 	}
+
+	log.Debug("Successfully wrote Markdown file", zap.String("url", link.URL), zap.String("fileName", fileName))
+	return fileName, nil
+}
+
+// contextTransport makes the requests of a collector with the given context, so they are aborted
+// as soon as the import is canceled.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
 }
 
 func IsURL(value string) bool {
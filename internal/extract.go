@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// The extraction of the main content of pages follows the scoring of Mozilla's Readability: paragraphs
+// give points to their parent and grandparent, boosted or penalized by the class and id of the elements,
+// and the element with the most points, once weighted by its density of links, is taken as the article.
+var (
+	// unlikelyCandidates match the class and id of elements that are removed before scoring the page,
+	// unless they also match maybeCandidates.
+	unlikelyCandidates = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|consent|cookie|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|newsletter|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote`)
+	maybeCandidates    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	// positiveNames and negativeNames match the class and id of elements more or less likely to hold the article.
+	positiveNames = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negativeNames = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|footer|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|widget`)
+	// unlikelyRoles are the ARIA roles of elements that are never part of an article. Alerts are kept, as
+	// articles use them for their note boxes.
+	unlikelyRoles = map[string]bool{"menu": true, "menubar": true, "complementary": true, "navigation": true, "alertdialog": true, "dialog": true}
+)
+
+const (
+	// minParagraphLength is the length in characters under which a paragraph does not count towards the score.
+	minParagraphLength = 25
+	// minArticleLength is the length in characters under which the extracted article is considered a failure,
+	// and the full page is kept instead.
+	minArticleLength = 200
+)
+
+// ExtractArticle returns the main content of the page, leaving out its navigation, banners, footers, comments
+// and other boilerplate. The page itself is returned when no element holds enough text to be its article.
+// The page is not modified.
+func ExtractArticle(page *goquery.Selection) *goquery.Selection {
+	doc := page.Clone()
+	removeBoilerplate(doc)
+
+	candidates, scores := scoreParagraphs(doc)
+	var top *html.Node
+	topScore := 0.0
+	for _, node := range candidates {
+		score := scores[node] * (1 - linkDensity(goquery.NewDocumentFromNode(node).Selection))
+		scores[node] = score
+		if top == nil || score > topScore {
+			top, topScore = node, score
+		}
+	}
+	if top == nil {
+		return page
+	}
+
+	article := collectArticle(top, topScore, scores)
+	if utf8.RuneCountInString(normalizedText(article)) < minArticleLength {
+		return page
+	}
+	return article
+}
+
+// removeBoilerplate removes the elements that cannot be part of an article, such as scripts, forms and
+// navigation, along with the elements whose class, id or role mark them as boilerplate.
+func removeBoilerplate(doc *goquery.Selection) {
+	doc.Find("script:not([type^='math/tex']), style, noscript, template, iframe, form, nav, button, input:not([type=checkbox]), select, textarea, dialog").Remove()
+	doc.Find("[hidden], [aria-hidden=true]").Remove()
+
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		if goquery.NodeName(s) == "body" || goquery.NodeName(s) == "article" || goquery.NodeName(s) == "main" {
+			return
+		}
+		if unlikelyRoles[s.AttrOr("role", "")] {
+			s.Remove()
+			return
+		}
+		names := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikelyCandidates.MatchString(names) && !maybeCandidates.MatchString(names) && s.Find("article, main").Length() == 0 {
+			s.Remove()
+		}
+	})
+}
+
+// scoreParagraphs gives each paragraph of the page points for its length and commas, and adds them to the
+// score of its parent and, halved, of its grandparent. It returns these candidate elements, in the order they
+// were found, and their scores.
+func scoreParagraphs(doc *goquery.Selection) ([]*html.Node, map[*html.Node]float64) {
+	var candidates []*html.Node
+	scores := make(map[*html.Node]float64)
+	doc.Find("p, pre, td, section, h2, h3, h4, h5, h6").Each(func(_ int, s *goquery.Selection) {
+		text := normalizedText(s)
+		length := utf8.RuneCountInString(text)
+		if length < minParagraphLength {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(length)/100, 3)
+		for level, ancestor := range []*html.Node{s.Get(0).Parent, grandparent(s.Get(0))} {
+			if ancestor == nil || ancestor.Type != html.ElementNode || ancestor.DataAtom == atom.Body || ancestor.DataAtom == atom.Html {
+				continue
+			}
+			if _, ok := scores[ancestor]; !ok {
+				candidates = append(candidates, ancestor)
+				scores[ancestor] = initialScore(ancestor)
+			}
+			scores[ancestor] += score / float64(level+1)
+		}
+	})
+	return candidates, scores
+}
+
+func grandparent(node *html.Node) *html.Node {
+	if node.Parent == nil {
+		return nil
+	}
+	return node.Parent.Parent
+}
+
+// initialScore returns the score of an element before its paragraphs are counted, from its tag and names.
+func initialScore(node *html.Node) float64 {
+	score := 0.0
+	switch node.DataAtom {
+	case atom.Article:
+		score += 10
+	case atom.Div, atom.Main:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+
+	s := goquery.NewDocumentFromNode(node).Selection
+	for _, name := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if name == "" {
+			continue
+		}
+		if negativeNames.MatchString(name) {
+			score -= 25
+		}
+		if positiveNames.MatchString(name) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// linkDensity returns the share of the text of the element that is the text of links.
+func linkDensity(s *goquery.Selection) float64 {
+	length := utf8.RuneCountInString(normalizedText(s))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linkLength += utf8.RuneCountInString(normalizedText(a))
+	})
+	return float64(linkLength) / float64(length)
+}
+
+// collectArticle returns an element holding the top candidate, along with its siblings that score well
+// enough or read as paragraphs of the article, such as an introduction split off from the rest of the text.
+func collectArticle(top *html.Node, topScore float64, scores map[*html.Node]float64) *goquery.Selection {
+	article := goquery.NewDocumentFromNode(&html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}).Selection
+	if top.Parent == nil {
+		article.AppendNodes(top)
+		return article
+	}
+
+	threshold := max(10, topScore*0.2)
+	var siblings []*html.Node
+	for sibling := top.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Type != html.ElementNode {
+			continue
+		}
+		if sibling == top || scores[sibling] >= threshold || isArticleParagraph(sibling) {
+			siblings = append(siblings, sibling)
+		}
+	}
+	for _, sibling := range siblings {
+		sibling.Parent.RemoveChild(sibling)
+	}
+	article.AppendNodes(siblings...)
+	return article
+}
+
+// isArticleParagraph reports whether the element is a paragraph of text that is not mostly made of links.
+func isArticleParagraph(node *html.Node) bool {
+	if node.DataAtom != atom.P {
+		return false
+	}
+	s := goquery.NewDocumentFromNode(node).Selection
+	length := utf8.RuneCountInString(normalizedText(s))
+	density := linkDensity(s)
+	return (length > 80 && density < 0.25) || (length > 0 && density == 0 && strings.Contains(normalizedText(s), ". "))
+}
+
+// normalizedText returns the text of the element with runs of whitespace collapsed to a single space.
+func normalizedText(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"time"
+)
+
+// Frontmatter holds the properties written in the frontmatter of the notes.
+type Frontmatter struct {
+	Title       string   `yaml:"title"`
+	Source      string   `yaml:"source"`
+	Author      []string `yaml:"author"`
+	Published   Date     `yaml:"published,omitempty"`
+	Created     Date     `yaml:"created"`
+	Description string   `yaml:"description,omitempty"`
+	Status      string   `yaml:"status,omitempty"`
+	Read        bool     `yaml:"read"`
+	Favorite    bool     `yaml:"favorite"`
+	Tags        []string `yaml:"tags"`
+}
+
+// newFrontmatter returns the properties of the note of the link.
+func newFrontmatter(link Link) Frontmatter {
+	return Frontmatter{
+		Title:       link.TitleValue(),
+		Source:      link.URL,
+		Author:      []string{link.Author()},
+		Published:   Date(link.PublishedTime()),
+		Created:     Date(link.TimeAdded),
+		Description: strings.TrimSpace(link.Description()),
+		Status:      link.Status,
+		Read:        link.Read(),
+		Favorite:    link.Favorite,
+		Tags:        noteTags(link),
+	}
+}
+
+// Date is a time written in the frontmatter as a date, which Obsidian shows as a date property.
+type Date time.Time
+
+// IsZero reports whether the date is not set, so that it is left out of the frontmatter.
+func (d Date) IsZero() bool {
+	return time.Time(d).IsZero()
+}
+
+// MarshalYAML writes the date as an unquoted YAML timestamp.
+func (d Date) MarshalYAML() (any, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: time.Time(d).Format("2006-01-02")}, nil
+}
+
+// UnmarshalYAML reads a date written as a YAML timestamp.
+func (d *Date) UnmarshalYAML(node *yaml.Node) error {
+	var t time.Time
+	if err := node.Decode(&t); err != nil {
+		return err
+	}
+	*d = Date(t)
+	return nil
+}
+
+// encodeYAML encodes the value as YAML, with its strings double-quoted the way the notes quote them.
+func encodeYAML(value any) (string, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return "", fmt.Errorf("error encoding YAML: %w", err)
+	}
+	quoteStrings(node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return "", fmt.Errorf("error encoding YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("error encoding YAML: %w", err)
+	}
+	return buf.String(), nil
+}
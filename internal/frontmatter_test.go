@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrontmatterRoundTrip(t *testing.T) {
+	templates, err := ParseNoteTemplates("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		title       string
+		description string
+	}{
+		{name: "backslashes", title: `C:\Users\me and \n`, description: `A \d+ regex`},
+		{name: "newlines", title: "First line\nsecond line", description: "One\n\ntwo\r\nthree"},
+		{name: "colons", title: "Go: a tour", description: "key: value # not a comment"},
+		{name: "quotes", title: `"Quoted" and 'single'`, description: `He said "hi" 'there'`},
+		{name: "ampersands", title: "Tom & Jerry &amp; friends", description: "<b>R&D</b> &copy;"},
+		{name: "yaml values", title: "null", description: "2024-01-01"},
+		{name: "yaml syntax", title: "- [not, a list] {or: map}", description: "| literal > folded *alias &anchor !tag"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link := Link{
+				Title:     "Export title",
+				URL:       "https://example.com/article",
+				TimeAdded: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+				Meta:      map[string]string{"title": test.title, "description": test.description},
+			}
+
+			content, err := templates.Render(link, "content")
+			if err != nil {
+				t.Fatal(err)
+			}
+			note, err := parseNote("note.md", content)
+			if err != nil {
+				t.Fatalf("error parsing note:\n%s\n%v", content, err)
+			}
+			var frontmatter Frontmatter
+			if err := note.Frontmatter.Decode(&frontmatter); err != nil {
+				t.Fatal(err)
+			}
+
+			if frontmatter.Title != test.title {
+				t.Errorf("title = %q, want %q", frontmatter.Title, test.title)
+			}
+			if frontmatter.Description != test.description {
+				t.Errorf("description = %q, want %q", frontmatter.Description, test.description)
+			}
+			if frontmatter.Source != link.URL {
+				t.Errorf("source = %q, want %q", frontmatter.Source, link.URL)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// journalPath is the path of the journal file, relative to the output folder.
+const journalPath = ".migrator/journal.jsonl"
+
+// Journal keeps track of the results of an import on disk, so an interrupted import can be resumed
+// without visiting the links that were already written again. Results are appended to the journal
+// file as JSON lines as soon as they are known, the last result of a URL taking precedence.
+type Journal struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	results map[string]CrawlResult
+}
+
+// OpenJournal opens the journal of the given output folder. When resuming, the results of the
+// previous imports are loaded from it, otherwise it is cleared.
+func OpenJournal(baseFolder string, resume bool) (*Journal, error) {
+	absPath, err := filepath.Abs(filepath.Join(baseFolder, journalPath))
+	if err != nil {
+		return nil, fmt.Errorf("error getting absolute path for %s: %w", baseFolder, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(absPath), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating journal folder %s: %w", filepath.Dir(absPath), err)
+	}
+
+	j := &Journal{
+		path:    absPath,
+		results: make(map[string]CrawlResult),
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if resume {
+		if err := j.load(); err != nil {
+			return nil, err
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	j.file, err = os.OpenFile(absPath, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal %s: %w", absPath, err)
+	}
+
+	return j, nil
+}
+
+// load reads the results recorded in the journal file, if it exists. A truncated last line, left by
+// a crash while it was written, is ignored.
+func (j *Journal) load() error {
+	file, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening journal %s: %w", j.path, err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var result CrawlResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+		j.results[result.URL] = result
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading journal %s: %w", j.path, err)
+	}
+
+	return nil
+}
+
+// Completed returns the recorded result of the URL when its Markdown file was already written or skipped.
+func (j *Journal) Completed(url string) (CrawlResult, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	result, ok := j.results[url]
+	return result, ok && result.Success
+}
+
+// Len returns the number of URLs with a recorded result.
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return len(j.results)
+}
+
+// Record appends the result to the journal file.
+func (j *Journal) Record(result CrawlResult) error {
+	line, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding journal entry for %s: %w", result.URL, err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.results[result.URL] = result
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing journal %s: %w", j.path, err)
+	}
+	return nil
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostOf returns the lower-cased host name of the URL, or an empty string if it cannot be parsed.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// RateLimit is the pace at which requests are made to a host.
+type RateLimit struct {
+	// RequestsPerSecond is the maximum rate of requests to the host, with no limit when not positive.
+	RequestsPerSecond float64
+	// RandomDelay is the maximum random delay added before each request to the host.
+	RandomDelay time.Duration
+}
+
+func (r RateLimit) interval() time.Duration {
+	if r.RequestsPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / r.RequestsPerSecond)
+}
+
+// rateLimiter paces the requests made to each host, using the rate limit of the domain of the host
+// when one is set, or the global rate limit otherwise.
+type rateLimiter struct {
+	global  RateLimit
+	domains map[string]RateLimit
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// newRateLimiter initializes a rateLimiter with the given global rate limit and no domain rate limits.
+func newRateLimiter(global RateLimit) *rateLimiter {
+	return &rateLimiter{
+		global:  global,
+		domains: make(map[string]RateLimit),
+		next:    make(map[string]time.Time),
+	}
+}
+
+// SetDomain sets the rate limit of the domain, which applies to the domain and all its subdomains.
+func (r *rateLimiter) SetDomain(domain string, limit RateLimit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.domains[strings.ToLower(strings.TrimPrefix(domain, "."))] = limit
+}
+
+// limitFor returns the rate limit of the most specific domain matching the host, or the global rate limit.
+// The caller must hold the lock.
+func (r *rateLimiter) limitFor(host string) RateLimit {
+	limit, matched := r.global, ""
+	for domain, domainLimit := range r.domains {
+		if (host == domain || strings.HasSuffix(host, "."+domain)) && len(domain) > len(matched) {
+			limit, matched = domainLimit, domain
+		}
+	}
+	return limit
+}
+
+// Reserve books the next request to the host allowed by its rate limit, and returns the time it can be made at.
+func (r *rateLimiter) Reserve(host string) time.Time {
+	r.mu.Lock()
+	limit := r.limitFor(host)
+	now := time.Now()
+	at := now
+	if next, ok := r.next[host]; ok && next.After(now) {
+		at = next
+	}
+	r.next[host] = at.Add(limit.interval())
+	r.mu.Unlock()
+
+	if limit.RandomDelay > 0 {
+		at = at.Add(rand.N(limit.RandomDelay))
+	}
+	return at
+}
+
+// Wait blocks until a request can be made to the host without exceeding its rate limit, or the context is done.
+func (r *rateLimiter) Wait(ctx context.Context, host string) error {
+	delay := time.Until(r.Reserve(host))
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff holds off the next requests to the host for at least the given duration, such as
+// when the host responded with a Retry-After header.
+func (r *rateLimiter) Backoff(host string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if next, ok := r.next[host]; !ok || next.Before(until) {
+		r.next[host] = until
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, given either as a number of seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
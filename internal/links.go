@@ -5,11 +5,8 @@ import (
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal/logger"
-	"github.com/gocarina/gocsv"
 	"github.com/gocolly/colly"
 	"go.uber.org/zap"
-	"html"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -25,7 +22,15 @@ type Link struct {
 	TimeAdded time.Time         `json:"time_added,omitempty" csv:"time_added"`
 	Tags      []string          `json:"tags,omitempty" csv:"tags"`
 	Status    string            `json:"status,omitempty" csv:"status"`
+	Favorite  bool              `json:"favorite,omitempty" csv:"favorite"`
 	Meta      map[string]string `json:"meta,omitempty" csv:"meta"`
+	// Highlights are the passages highlighted in Pocket, only available from ZIP exports.
+	Highlights []Highlight `json:"highlights,omitempty" csv:"-"`
+}
+
+// Read reports whether the link was read, which Pocket records by archiving it.
+func (l *Link) Read() bool {
+	return l.Status == "archive"
 }
 
 func (l *Link) String() string {
@@ -35,13 +40,13 @@ func (l *Link) String() string {
 func (l *Link) TitleValue() string {
 	if l.Meta != nil {
 		if title, ok := l.Meta["og:title"]; ok && title != "" {
-			return html.EscapeString(title)
+			return title
 		}
 		if title, ok := l.Meta["title"]; ok && title != "" {
-			return html.EscapeString(title)
+			return title
 		}
 	}
-	return html.EscapeString(l.Title)
+	return l.Title
 }
 
 func (l *Link) Author() string {
@@ -95,7 +100,7 @@ func (l *Link) ProcessMetaTags(e *colly.HTMLElement) {
 		})
 
 		if meta["title"] == "" {
-			meta["title"] = html.EscapeString(l.Title) // Fallback to link title if no title tag found
+			meta["title"] = l.Title // Fallback to link title if no title tag found
 		}
 	}
 
@@ -114,6 +119,7 @@ func (l *Link) ToRawLink() RawLink {
 		TimeAdded: l.TimeAdded.Unix(),
 		Tags:      tags,
 		Status:    l.Status,
+		Favorite:  l.Favorite,
 	}
 }
 
@@ -123,6 +129,7 @@ type RawLink struct {
 	TimeAdded int64  `json:"time_added,omitempty" csv:"time_added"`
 	Tags      string `json:"tags,omitempty" csv:"tags"`
 	Status    string `json:"status,omitempty" csv:"status"`
+	Favorite  bool   `json:"favorite,omitempty" csv:"favorite"`
 }
 
 func (r *RawLink) ToLink() Link {
@@ -133,6 +140,7 @@ func (r *RawLink) ToLink() Link {
 		URL:       r.URL,
 		TimeAdded: timeAdded,
 		Status:    r.Status,
+		Favorite:  r.Favorite,
 	}
 
 	if r.Tags != "" {
@@ -144,33 +152,34 @@ func (r *RawLink) ToLink() Link {
 	return link
 }
 
+// ImportFrom detects the format of the export file at the given path and imports its links.
 func (l *Links) ImportFrom(ctx context.Context, path string) error {
-	log := logger.Logger(ctx)
-
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("error getting absolute path for %s: %w", path, err)
 	}
 
-	log.Debug("Importing links from file", zap.String("path", absPath))
-
-	linksFile, err := os.OpenFile(absPath, os.O_RDWR|os.O_CREATE, os.ModePerm)
+	source, err := DetectSource(absPath)
 	if err != nil {
-		return fmt.Errorf("error opening file %s: %w", absPath, err)
+		return err
 	}
 
-	defer func(linksFile *os.File) {
-		_ = linksFile.Close()
-	}(linksFile)
+	return l.ImportFromSource(ctx, source, absPath)
+}
 
-	rawLinks := make([]RawLink, 0)
-	if err := gocsv.UnmarshalFile(linksFile, &rawLinks); err != nil {
-		return fmt.Errorf("error unmarshalling CSV file %s: %w", absPath, err)
-	}
+// ImportFromSource imports the links of the export file at the given path using the given source.
+func (l *Links) ImportFromSource(ctx context.Context, source Source, path string) error {
+	log := logger.Logger(ctx)
 
-	for _, raw := range rawLinks {
-		l.Links = append(l.Links, raw.ToLink())
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("error getting absolute path for %s: %w", path, err)
 	}
 
-	return nil
+	log.Debug("Importing links from file", zap.String("path", absPath), zap.String("source", source.Name()))
+
+	return source.Read(ctx, absPath, func(link Link) error {
+		l.Links = append(l.Links, link)
+		return nil
+	})
 }
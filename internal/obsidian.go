@@ -0,0 +1,450 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/JohannesKaufmann/dom"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/marker"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The Obsidian rules of the converter mark the elements with an Obsidian equivalent while preparing the
+// page, by setting their obsidianAttr attribute to one of these kinds, and then render them in the Obsidian
+// syntax. Marked elements are spans and divs, so they keep the spacing of inline and block elements.
+const (
+	obsidianAttr = "data-obsidian"
+
+	calloutKind     = "callout"
+	mathKind        = "math"
+	footnoteRefKind = "footnote-ref"
+	footnoteKind    = "footnote"
+)
+
+// calloutBoxes select the boxes of pages rendered as callouts: asides, admonitions of Sphinx and MkDocs,
+// alerts of GitHub and Bootstrap, and the note boxes of blogs.
+const calloutBoxes = "aside, [role=note], .admonition, .markdown-alert, .callout, .alert, .notice, " +
+	"div.note, div.tip, div.warning, div.info, div.important, div.caution, div.danger, section.note"
+
+// calloutTitles select the titles of callout boxes.
+const calloutTitles = ".admonition-title, .markdown-alert-title, .callout-title, .alert-heading, .notice-title"
+
+// calloutTypes are the callout types of Obsidian, along with their aliases.
+var calloutTypes = map[string]bool{
+	"note": true, "abstract": true, "summary": true, "tldr": true, "info": true, "todo": true, "tip": true,
+	"hint": true, "important": true, "success": true, "check": true, "done": true, "question": true,
+	"help": true, "faq": true, "warning": true, "caution": true, "attention": true, "failure": true,
+	"fail": true, "missing": true, "danger": true, "error": true, "bug": true, "example": true,
+	"quote": true, "cite": true,
+}
+
+// calloutTypePrefixes are the prefixes of the classes holding the type of callout boxes.
+var calloutTypePrefixes = []string{"admonition-", "markdown-alert-", "callout-", "alert-", "notice-"}
+
+// mathScripts select the TeX sources MathJax reads from scripts.
+const mathScripts = `script[type^="math/tex"]`
+
+// texDelimiters match the TeX delimited in the text of pages rendered by MathJax in the browser.
+var texDelimiters = regexp.MustCompile(`(?s)\\\((.+?)\\\)|\\\[(.+?)\\\]|\$\$(.+?)\$\$`)
+
+// footnoteRefs select the links to footnotes, as written by Markdown renderers, Pandoc and MediaWiki.
+const footnoteRefs = `a[role=doc-noteref], a.footnote-ref, a.footnote, sup > a[href^="#fn"], sup.reference > a, sup[id^=fnref] > a`
+
+// footnoteBacklinks select the links back to the text from footnotes.
+const footnoteBacklinks = `a[role=doc-backlink], a.footnote-backref, a.footnote-back, a.reversefootnote, a[href^="#fnref"], .mw-cite-backlink`
+
+// obsidianPlugin renders the elements of pages that have an equivalent in the syntax of Obsidian: marked
+// text as highlights, note boxes as callouts, figures as an image followed by its caption, math as LaTeX
+// and footnotes as Markdown footnotes.
+type obsidianPlugin struct{}
+
+func (p *obsidianPlugin) Name() string {
+	return "obsidian"
+}
+
+func (p *obsidianPlugin) Init(conv *converter.Converter) error {
+	// Scripts holding math must be read before the base plugin removes them
+	conv.Register.PreRenderer(p.handlePreRender, converter.PriorityEarly-10)
+
+	conv.Register.RendererFor("mark", converter.TagTypeInline, p.renderHighlight, converter.PriorityStandard)
+	conv.Register.RendererFor("figure", converter.TagTypeBlock, p.renderFigure, converter.PriorityStandard)
+	conv.Register.Renderer(p.handleRender, converter.PriorityEarly)
+
+	// Dollars start math and double equal signs highlights in Obsidian, so they are escaped in text
+	conv.Register.EscapedChar('$', '=')
+	conv.Register.UnEscaper(p.handleUnEscapers, converter.PriorityStandard)
+
+	return nil
+}
+
+func (p *obsidianPlugin) handleUnEscapers(chars []byte, index int) int {
+	switch chars[index] {
+	case '$':
+		return 1
+	case '=':
+		next := index + 1
+		if next < len(chars) && chars[next] == marker.BytesMarkerEscaping[0] {
+			next++
+		}
+		if next < len(chars) && chars[next] == '=' {
+			return 1
+		}
+	}
+	return -1
+}
+
+func (p *obsidianPlugin) handleRender(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	switch dom.GetAttributeOr(n, obsidianAttr, "") {
+	case calloutKind:
+		return p.renderCallout(ctx, w, n)
+	case mathKind:
+		return p.renderMath(ctx, w, n)
+	case footnoteRefKind:
+		return p.renderFootnoteRef(ctx, w, n)
+	case footnoteKind:
+		return p.renderFootnote(ctx, w, n)
+	}
+	return converter.RenderTryNext
+}
+
+func (p *obsidianPlugin) handlePreRender(_ converter.Context, doc *html.Node) {
+	page := goquery.NewDocumentFromNode(doc).Selection
+
+	prepareMath(page)
+	prepareFootnotes(page)
+	prepareCallouts(page)
+}
+
+// prepareMath replaces the math rendered by KaTeX and MathJax, and the TeX left in the text for MathJax to
+// render in the browser, with math elements holding their TeX source.
+func prepareMath(page *goquery.Selection) {
+	// KaTeX keeps the source of its math in an annotation of the MathML it renders
+	for _, katex := range page.Find(".katex").EachIter() {
+		tex := strings.TrimSpace(katex.Find(`annotation[encoding="application/x-tex"]`).First().Text())
+		if tex != "" {
+			replaceWithMath(katex, tex, katex.ParentsFiltered(".katex-display").Length() > 0)
+		}
+	}
+
+	// MathJax reads its source from scripts, and renders it next to them
+	page.Find(".MathJax_Preview, .MathJax, .MathJax_Display, mjx-container, .MathJax_SVG_Display").Each(func(_ int, rendered *goquery.Selection) {
+		if rendered.Next().Is(mathScripts) || rendered.Prev().Is(mathScripts) {
+			rendered.Remove()
+		}
+	})
+	for _, script := range page.Find(mathScripts).EachIter() {
+		replaceWithMath(script, strings.TrimSpace(script.Text()), strings.Contains(script.AttrOr("type", ""), "mode=display"))
+	}
+
+	// MathML, as left by MathJax 3 and MediaWiki, may hold its source in an annotation or its alttext
+	for _, math := range page.Find("math").EachIter() {
+		tex := strings.TrimSpace(math.Find(`annotation[encoding="application/x-tex"]`).First().Text())
+		if tex == "" {
+			tex = strings.TrimSpace(math.AttrOr("alttext", ""))
+		}
+		if tex == "" {
+			continue
+		}
+		target := math
+		if wrapper := math.Closest("mjx-container, .mwe-math-element"); wrapper.Length() > 0 {
+			target = wrapper
+		}
+		replaceWithMath(target, tex, math.AttrOr("display", "") == "block" || target.AttrOr("display", "") == "true")
+	}
+
+	// TeX delimited in the text of the page, outside of code
+	for _, node := range textNodes(page) {
+		replaceTexDelimiters(node)
+	}
+}
+
+// newMarkedNode returns an element with the given tag and text, marked as an element of the given kind.
+// The text is not rendered, but keeps the whitespace around the element from being collapsed as if it
+// were empty.
+func newMarkedNode(tag string, kind string, text string) *html.Node {
+	node := &html.Node{Type: html.ElementNode, Data: tag, DataAtom: atom.Lookup([]byte(tag))}
+	node.Attr = append(node.Attr, html.Attribute{Key: obsidianAttr, Val: kind})
+	node.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+	return node
+}
+
+// replaceWithMath replaces the element with a math element holding the TeX source.
+func replaceWithMath(element *goquery.Selection, tex string, display bool) {
+	math := newMarkedNode("span", mathKind, tex)
+	math.Attr = append(math.Attr, html.Attribute{Key: "data-tex", Val: tex})
+	if display {
+		math.Attr = append(math.Attr, html.Attribute{Key: "data-display", Val: "true"})
+	}
+	element.ReplaceWithNodes(math)
+}
+
+// textNodes returns the text nodes of the page, except those of code and scripts.
+func textNodes(page *goquery.Selection) []*html.Node {
+	var nodes []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "pre", "code", "script", "style", "textarea":
+				return
+			}
+			if dom.GetAttributeOr(n, obsidianAttr, "") != "" {
+				return
+			}
+		}
+		if n.Type == html.TextNode {
+			nodes = append(nodes, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, node := range page.Nodes {
+		walk(node)
+	}
+	return nodes
+}
+
+// replaceTexDelimiters splits the text node around the TeX it holds, delimited by \( \), \[ \] or $$,
+// replacing the TeX with math elements.
+func replaceTexDelimiters(node *html.Node) {
+	matches := texDelimiters.FindAllStringSubmatchIndex(node.Data, -1)
+	if len(matches) == 0 || node.Parent == nil {
+		return
+	}
+
+	text := node.Data
+	offset := 0
+	for _, match := range matches {
+		if match[0] > offset {
+			node.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[offset:match[0]]}, node)
+		}
+
+		for group := 1; group <= 3; group++ {
+			if start := match[2*group]; start >= 0 {
+				tex := strings.TrimSpace(text[start:match[2*group+1]])
+				math := newMarkedNode("span", mathKind, tex)
+				math.Attr = append(math.Attr, html.Attribute{Key: "data-tex", Val: tex})
+				if group > 1 {
+					math.Attr = append(math.Attr, html.Attribute{Key: "data-display", Val: "true"})
+				}
+				node.Parent.InsertBefore(math, node)
+			}
+		}
+		offset = match[1]
+	}
+	node.Data = text[offset:]
+}
+
+// prepareFootnotes replaces the links to footnotes with footnote references, numbered in the order they
+// are first referenced, and moves the footnotes they point to at the end of the page.
+func prepareFootnotes(page *goquery.Selection) {
+	labels := make(map[string]string)
+	var footnotes []*goquery.Selection
+	for _, ref := range page.Find(footnoteRefs).EachIter() {
+		id := strings.TrimPrefix(ref.AttrOr("href", ""), "#")
+		if id == "" {
+			continue
+		}
+		footnote := findByID(page, id)
+		if footnote.Length() == 0 {
+			continue
+		}
+		if !footnote.Is("li") {
+			footnote = footnote.Closest("li")
+		}
+		if footnote.Length() == 0 {
+			continue
+		}
+
+		label, ok := labels[id]
+		if !ok {
+			label = strconv.Itoa(len(labels) + 1)
+			labels[id] = label
+			footnotes = append(footnotes, footnote.SetAttr("data-label", label))
+		}
+
+		target := ref
+		if parent := ref.Parent(); parent.Is("sup") && strings.TrimSpace(parent.Text()) == strings.TrimSpace(ref.Text()) {
+			target = parent
+		}
+		refNode := newMarkedNode("span", footnoteRefKind, label)
+		refNode.Attr = append(refNode.Attr, html.Attribute{Key: "data-label", Val: label})
+		target.ReplaceWithNodes(refNode)
+	}
+	if len(footnotes) == 0 {
+		return
+	}
+
+	end := page.Find("body").First()
+	if end.Length() == 0 {
+		end = page
+	}
+	for _, footnote := range footnotes {
+		footnote.Find(footnoteBacklinks).Remove()
+		list := footnote.Closest(".footnotes, [role=doc-endnotes], ol.references")
+		if list.Length() == 0 {
+			list = footnote.Closest("ol")
+		}
+
+		footnote.Get(0).Data = "div"
+		footnote.Get(0).DataAtom = atom.Div
+		footnote.SetAttr(obsidianAttr, footnoteKind)
+		footnote.Remove()
+		end.AppendSelection(footnote)
+
+		// Drop the list of footnotes once all of them were moved
+		if list.Length() > 0 && list.Find("li").Length() == 0 {
+			list.Remove()
+		}
+	}
+}
+
+// findByID returns the element of the page with the given id.
+func findByID(page *goquery.Selection, id string) *goquery.Selection {
+	return page.FindMatcher(goquery.Single(fmt.Sprintf("[id=%q]", id)))
+}
+
+// prepareCallouts replaces the note boxes of the page with callouts, typed after their classes and titled
+// after their heading.
+func prepareCallouts(page *goquery.Selection) {
+	for _, box := range page.Find(calloutBoxes).EachIter() {
+		if box.Closest("pre, code").Length() > 0 {
+			continue
+		}
+
+		title := box.ChildrenFiltered(calloutTitles).First()
+		if title.Length() == 0 {
+			title = box.Find(calloutTitles).First()
+		}
+		if title.Length() > 0 {
+			box.SetAttr("data-title", strings.Join(strings.Fields(title.Text()), " "))
+			title.Remove()
+		}
+
+		box.SetAttr("data-type", calloutType(box))
+		box.SetAttr(obsidianAttr, calloutKind)
+	}
+}
+
+// calloutType returns the Obsidian callout type matching the classes of the box, or note.
+func calloutType(box *goquery.Selection) string {
+	for _, class := range strings.Fields(strings.ToLower(box.AttrOr("class", ""))) {
+		for _, prefix := range calloutTypePrefixes {
+			class = strings.TrimPrefix(class, prefix)
+		}
+		if calloutTypes[class] {
+			return class
+		}
+	}
+	return "note"
+}
+
+// renderHighlight renders marked text as an Obsidian highlight.
+func (p *obsidianPlugin) renderHighlight(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	var buf bytes.Buffer
+	ctx.RenderChildNodes(ctx, &buf, n)
+	content := bytes.TrimSpace(buf.Bytes())
+	if len(content) == 0 {
+		return converter.RenderSuccess
+	}
+
+	// Highlights cannot span several paragraphs, each line is highlighted on its own
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		if i > 0 {
+			_, _ = w.WriteString("\n")
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			_, _ = w.WriteString("==" + string(line) + "==")
+		}
+	}
+	return converter.RenderSuccess
+}
+
+// renderFigure renders the content of a figure followed by its caption, in italics. The caption is wrapped
+// in underscores, so it can hold text emphasized with asterisks.
+func (p *obsidianPlugin) renderFigure(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	var content, caption bytes.Buffer
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == "figcaption" {
+			ctx.RenderChildNodes(ctx, &caption, child)
+		} else {
+			ctx.RenderNodes(ctx, &content, child)
+		}
+	}
+
+	_, _ = w.WriteString("\n\n")
+	_, _ = w.Write(bytes.TrimSpace(content.Bytes()))
+	if text := strings.Join(strings.Fields(caption.String()), " "); text != "" {
+		_, _ = w.WriteString("\n_" + text + "_")
+	}
+	_, _ = w.WriteString("\n\n")
+	return converter.RenderSuccess
+}
+
+// renderCallout renders a note box as an Obsidian callout.
+func (p *obsidianPlugin) renderCallout(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	var buf bytes.Buffer
+	ctx.RenderChildNodes(ctx, &buf, n)
+
+	header := "[!" + dom.GetAttributeOr(n, "data-type", "note") + "]"
+	if title := dom.GetAttributeOr(n, "data-title", ""); title != "" {
+		header += " " + title
+	}
+
+	_, _ = w.WriteString("\n\n")
+	_, _ = w.WriteString(prefixLines(header+"\n"+collapseNewlines(strings.TrimSpace(buf.String())), "> "))
+	_, _ = w.WriteString("\n\n")
+	return converter.RenderSuccess
+}
+
+// renderMath renders math as LaTeX, between single dollars inline and double dollars for display math.
+func (p *obsidianPlugin) renderMath(_ converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	tex := dom.GetAttributeOr(n, "data-tex", "")
+	if dom.GetAttributeOr(n, "data-display", "") == "true" {
+		_, _ = w.WriteString("$$" + tex + "$$")
+	} else {
+		_, _ = w.WriteString("$" + tex + "$")
+	}
+	return converter.RenderSuccess
+}
+
+// renderFootnoteRef renders a reference to a footnote.
+func (p *obsidianPlugin) renderFootnoteRef(_ converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	_, _ = w.WriteString("[^" + dom.GetAttributeOr(n, "data-label", "") + "]")
+	return converter.RenderSuccess
+}
+
+// renderFootnote renders a footnote as a Markdown footnote, indenting the lines following the first one.
+func (p *obsidianPlugin) renderFootnote(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	var buf bytes.Buffer
+	ctx.RenderChildNodes(ctx, &buf, n)
+
+	content := collapseNewlines(strings.TrimSpace(buf.String()))
+	content = strings.ReplaceAll(content, "\n", "\n    ")
+	content = strings.ReplaceAll(content, "\n    \n", "\n\n")
+
+	_, _ = w.WriteString("\n\n[^" + dom.GetAttributeOr(n, "data-label", "") + "]: " + content + "\n\n")
+	return converter.RenderSuccess
+}
+
+// prefixLines adds the prefix to each line of the content, without trailing spaces on empty lines.
+func prefixLines(content string, prefix string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(prefix+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var consecutiveNewlines = regexp.MustCompile(`\n{3,}`)
+
+// collapseNewlines leaves at most one empty line between the lines of the content.
+func collapseNewlines(content string) string {
+	return consecutiveNewlines.ReplaceAllString(content, "\n\n")
+}
@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gocolly/colly"
+	"golang.org/x/text/unicode/norm"
+	"html"
+	"io"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultPathTemplate names notes after the title of their article, in the clippings folder.
+const DefaultPathTemplate = "clippings/{{.Name}}.md"
+
+// StatusPathTemplate places notes in a folder of the clippings folder named after the status of their link,
+// such as clippings/unread.
+const StatusPathTemplate = "clippings/{{.Status}}/{{.Name}}.md"
+
+const (
+	// maxSegmentLength is the maximum length in bytes of a folder or file name of a note path, including the
+	// suffixes added to disambiguate notes, kept well under the limit of most filesystems.
+	maxSegmentLength = 120
+	// maxSlugLength is the maximum length in bytes of the slug of a title.
+	maxSlugLength = 80
+)
+
+// PathData is the data available to the template of the note paths.
+type PathData struct {
+	// Title is the title of the article.
+	Title string
+	// Name is the title of the article sanitized as a file name, or its slug if nothing is left of it.
+	Name string
+	// Slug is the title of the article in lower case, with words separated by dashes.
+	Slug string
+	// Domain is the domain of the URL of the article, without any www prefix.
+	Domain string
+	// Year, Month and Day are the date the link was added, as zero-padded numbers.
+	Year  string
+	Month string
+	Day   string
+	// Tag is the first tag of the link, if any.
+	Tag string
+	// Status is the status of the link, such as unread or archive.
+	Status string
+	// Favorite is favorites for the links marked as a favorite, and empty for the others.
+	Favorite string
+}
+
+// newPathData returns the path data of the link.
+func newPathData(link Link) PathData {
+	title := link.TitleValue()
+
+	data := PathData{
+		Title:  pathField(title),
+		Name:   fileNameOf(title),
+		Slug:   Slugify(title),
+		Domain: strings.TrimPrefix(hostOf(link.URL), "www."),
+		Year:   link.TimeAdded.Format("2006"),
+		Month:  link.TimeAdded.Format("01"),
+		Day:    link.TimeAdded.Format("02"),
+		Status: pathField(link.Status),
+	}
+	if data.Name == "" {
+		data.Name = data.Slug
+	}
+	if len(link.Tags) > 0 {
+		data.Tag = pathField(link.Tags[0])
+	}
+	if link.Favorite {
+		data.Favorite = "favorites"
+	}
+	return data
+}
+
+// fileNameOf returns the title sanitized as a file name. The title is HTML escaped first, as it always was,
+// so the notes of links imported before keep their names.
+func fileNameOf(title string) string {
+	return strings.TrimSuffix(colly.SanitizeFileName(fmt.Sprintf("%s.md", html.EscapeString(title))), ".md")
+}
+
+// pathField replaces the path separators of the value of a field with dashes, so folders of the note paths
+// only come from the template, and not from titles such as TCP/IP or nested tags such as dev/go.
+func pathField(value string) string {
+	return strings.NewReplacer("/", "-", "\\", "-").Replace(value)
+}
+
+// PathTemplate renders the path of a note, relative to the output folder, from a text/template over PathData.
+type PathTemplate struct {
+	template *template.Template
+}
+
+// ParsePathTemplate parses the template of the note paths. Besides the built-in functions of text/template,
+// it can use slug and lower to format values.
+func ParsePathTemplate(text string) (*PathTemplate, error) {
+	t, err := template.New("path").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"slug":  Slugify,
+			"lower": strings.ToLower,
+		}).
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing path template %q: %w", text, err)
+	}
+
+	// Catch references to unknown fields before any note is written
+	if err := t.Execute(io.Discard, PathData{}); err != nil {
+		return nil, fmt.Errorf("error parsing path template %q: %w", text, err)
+	}
+
+	return &PathTemplate{template: t}, nil
+}
+
+// Render returns the path of the note for the data. Each folder and file name of the rendered path is made
+// safe for filesystems and shortened if needed, empty folders are dropped and the .md extension is added
+// when missing. The disambiguator, when set, is added to the file name once it is shortened, so links whose
+// paths are the same get different ones.
+func (t *PathTemplate) Render(data PathData, disambiguator string) (string, error) {
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error rendering path template: %w", err)
+	}
+
+	rendered := strings.TrimSuffix(strings.ReplaceAll(buf.String(), "\\", "/"), ".md")
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(rendered, "/") {
+		if segment = safeSegment(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("path template rendered an empty path for %q", data.Title)
+	}
+
+	if suffix := safeSegment(disambiguator); suffix != "" {
+		name := segments[len(segments)-1]
+		name = strings.TrimRight(truncate(name, maxSegmentLength-len(suffix)-1), " .")
+		segments[len(segments)-1] = name + " " + suffix
+	}
+
+	return path.Join(segments...) + ".md", nil
+}
+
+// safeSegment removes the characters of a folder or file name that are not allowed on common filesystems
+// or by Obsidian, and shortens it to maxSegmentLength. Names made only of dots are dropped.
+func safeSegment(segment string) string {
+	segment = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*#^[]`, r):
+			return '-'
+		}
+		return r
+	}, segment)
+
+	segment = strings.Trim(truncate(strings.TrimSpace(segment), maxSegmentLength), " .")
+	if strings.Trim(segment, ".") == "" {
+		return ""
+	}
+	return segment
+}
+
+// Slugify returns the value in lower case, without accents, with runs of characters other than letters
+// and digits replaced by a single dash, and shortened to maxSlugLength.
+func Slugify(value string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range norm.NFKD.String(value) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue // Drop the accents split off their letters
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+			dash = false
+		default:
+			dash = true
+		}
+	}
+
+	slug := strings.Trim(truncate(sb.String(), maxSlugLength), "-")
+	if slug == "" {
+		return "untitled"
+	}
+	return slug
+}
+
+// truncate shortens the value to at most the given number of bytes, without splitting a character.
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	for length > 0 && !utf8.RuneStart(value[length]) {
+		length--
+	}
+	return value[:length]
+}
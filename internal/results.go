@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ResultStatus is the outcome of the import of a link.
+type ResultStatus string
+
+const (
+	// ResultWritten is the status of a link whose Markdown file was written.
+	ResultWritten ResultStatus = "written"
+	// ResultSkipped is the status of a link whose note already existed and was left untouched.
+	ResultSkipped ResultStatus = "skipped"
+	// ResultFailed is the status of a link that could not be visited.
+	ResultFailed ResultStatus = "failed"
+	// ResultTimeout is the status of a link that did not respond in time.
+	ResultTimeout ResultStatus = "timeout"
+	// ResultNoContent is the status of a link that did not respond with an HTML page.
+	ResultNoContent ResultStatus = "no_content"
+	// ResultConversionError is the status of a link whose page could not be converted to Markdown.
+	ResultConversionError ResultStatus = "conversion_error"
+	// ResultWriteError is the status of a link whose Markdown file could not be written.
+	ResultWriteError ResultStatus = "write_error"
+	// ResultCanceled is the status of a link that was not visited because the import was canceled.
+	ResultCanceled ResultStatus = "canceled"
+)
+
+var (
+	// ErrNoContent is returned when a page has no HTML content to convert.
+	ErrNoContent = errors.New("no HTML content")
+	// ErrConversion is returned when the HTML content of a page cannot be converted to Markdown.
+	ErrConversion = errors.New("conversion error")
+	// ErrWrite is returned when the Markdown file of a page cannot be written.
+	ErrWrite = errors.New("write error")
+)
+
+// resultStatus returns the status of a link whose import ended with the given error.
+func resultStatus(err error) ResultStatus {
+	switch {
+	case err == nil:
+		return ResultWritten
+	case errors.Is(err, ErrNoteExists):
+		return ResultSkipped
+	case errors.Is(err, ErrNoContent):
+		return ResultNoContent
+	case errors.Is(err, ErrConversion):
+		return ResultConversionError
+	case errors.Is(err, ErrWrite):
+		return ResultWriteError
+	case errors.Is(err, context.Canceled):
+		return ResultCanceled
+	case IsTimeoutError(err):
+		return ResultTimeout
+	default:
+		return ResultFailed
+	}
+}
+
+// newCrawlResult returns the result of the import of a link, which ended with the given error after the given attempts.
+func newCrawlResult(link Link, attempts int, err error) CrawlResult {
+	result := CrawlResult{
+		RawLink:  link.ToRawLink(),
+		Status:   resultStatus(err),
+		Attempts: attempts,
+	}
+	result.Success = result.Status == ResultWritten || result.Status == ResultSkipped
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// resultCollector gathers the results of links imported concurrently, keeping exactly one result
+// per link, in the order of the links.
+type resultCollector struct {
+	links []Link
+
+	mu       sync.Mutex
+	results  []CrawlResult
+	recorded []bool
+}
+
+func newResultCollector(links []Link) *resultCollector {
+	return &resultCollector{
+		links:    links,
+		results:  make([]CrawlResult, len(links)),
+		recorded: make([]bool, len(links)),
+	}
+}
+
+// Record sets the result of the link at the given index, unless it already has one.
+func (r *resultCollector) Record(index int, result CrawlResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.recorded[index] {
+		return
+	}
+	r.results[index] = result
+	r.recorded[index] = true
+}
+
+// Results returns the result of each link, with links that have none recorded reported as canceled.
+func (r *resultCollector) Results() []CrawlResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]CrawlResult, len(r.results))
+	for i, result := range r.results {
+		if !r.recorded[i] {
+			result = newCrawlResult(r.links[i], 0, context.Canceled)
+		}
+		results[i] = result
+	}
+	return results
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed visit of a link is attempted again.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a link is visited, including the first attempt.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for each following retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts.
+	MaxDelay time.Duration
+	// RetryStatuses are the HTTP status codes for which a visit is retried.
+	// Timeouts, reset and refused connections and temporary DNS failures are always retried.
+	RetryStatuses []int
+}
+
+// DefaultRetryPolicy returns the policy retrying timeouts, dropped connections, rate limiting and server errors twice.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		RetryStatuses: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooEarly,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// Retriable reports whether a visit that failed with the given status code, zero if no response
+// was received, and error should be attempted again.
+func (p RetryPolicy) Retriable(statusCode int, err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if statusCode != 0 {
+		return slices.Contains(p.RetryStatuses, statusCode)
+	}
+	return IsTimeoutError(err) || isTransientNetworkError(err)
+}
+
+// isTransientNetworkError reports whether the error is a network failure that may not happen again: a
+// connection reset or refused by the host, or a DNS lookup that failed without finding the host missing.
+// Other failures, such as unknown hosts, invalid certificates or unsupported schemes, are permanent.
+func isTransientNetworkError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNABORTED) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+	}
+	return false
+}
+
+// Backoff returns the delay to wait for after the given attempt failed. It grows exponentially
+// with the number of attempts, with a random jitter of up to half of it to spread retries out.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	jitter := delay / 2
+	return delay - jitter + rand.N(jitter+1)
+}
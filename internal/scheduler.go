@@ -0,0 +1,122 @@
+package internal
+
+import "time"
+
+// linkTask is a link of a crawl waiting to be visited, with its position among the links of the crawl
+// and the number of attempts already made at it.
+type linkTask struct {
+	index    int
+	link     Link
+	host     string
+	attempts int
+
+	// notBefore is the time the task waits for before it can be visited, and reserved reports whether it
+	// holds a slot of its host, waiting for its request to the host to be allowed by the rate limiter.
+	notBefore time.Time
+	reserved  bool
+}
+
+// linkScheduler decides which link is visited next. Links are queued per host, and a link is only handed
+// out once its host has a free slot and the rate limit of the host allows a request, while links failing
+// with a retriable error are held back for the delay of their retry. Links waiting for their host or their
+// retry hold no worker. Hosts are taken in turn, in the order of their first link.
+// A linkScheduler is not safe for concurrent use, the crawl hands out its links from a single goroutine.
+type linkScheduler struct {
+	maxPerHost int
+	rates      *rateLimiter
+
+	queues  map[string][]linkTask
+	hosts   []string
+	active  map[string]int
+	turn    int
+	delayed []linkTask
+}
+
+// newLinkScheduler initializes a linkScheduler handing out up to maxPerHost links of a host at the same
+// time, or any number of them when maxPerHost is not positive, at the pace of the rate limiter.
+func newLinkScheduler(maxPerHost int, rates *rateLimiter) *linkScheduler {
+	return &linkScheduler{
+		maxPerHost: maxPerHost,
+		rates:      rates,
+		queues:     make(map[string][]linkTask),
+		active:     make(map[string]int),
+	}
+}
+
+// Push queues the task behind the other tasks of its host.
+func (s *linkScheduler) Push(task linkTask) {
+	if _, ok := s.queues[task.host]; !ok {
+		s.hosts = append(s.hosts, task.host)
+	}
+	s.queues[task.host] = append(s.queues[task.host], task)
+}
+
+// Retry holds the task back until the given time, and then queues it ahead of the other tasks of its host.
+func (s *linkScheduler) Retry(task linkTask, at time.Time) {
+	task.notBefore = at
+	task.reserved = false
+	s.delayed = append(s.delayed, task)
+}
+
+// Next returns the next task that can be visited, holding a slot of its host. When none can, it returns
+// the time the next held back task is due at, if any, or a zero time when no task can be visited until
+// a slot is released with Done.
+func (s *linkScheduler) Next(now time.Time) (linkTask, bool, time.Time) {
+	if task, ok := s.nextDelayed(now); ok {
+		return task, true, time.Time{}
+	}
+
+	for range len(s.hosts) {
+		host := s.hosts[s.turn%len(s.hosts)]
+		s.turn++
+
+		queue := s.queues[host]
+		if len(queue) == 0 || (s.maxPerHost > 0 && s.active[host] >= s.maxPerHost) {
+			continue
+		}
+		task := queue[0]
+		s.queues[host] = queue[1:]
+		s.active[host]++
+
+		// The task keeps the slot of its host while it waits for the rate limit of the host
+		if at := s.rates.Reserve(host); at.After(now) {
+			task.notBefore = at
+			task.reserved = true
+			s.delayed = append(s.delayed, task)
+			continue
+		}
+		return task, true, time.Time{}
+	}
+
+	var wake time.Time
+	for _, task := range s.delayed {
+		if wake.IsZero() || task.notBefore.Before(wake) {
+			wake = task.notBefore
+		}
+	}
+	return linkTask{}, false, wake
+}
+
+// nextDelayed returns the first held back task that is due and holds a slot of its host. The retried
+// tasks that are due are queued back ahead of the other tasks of their host.
+func (s *linkScheduler) nextDelayed(now time.Time) (linkTask, bool) {
+	for i := 0; i < len(s.delayed); i++ {
+		task := s.delayed[i]
+		if task.notBefore.After(now) {
+			continue
+		}
+		s.delayed = append(s.delayed[:i], s.delayed[i+1:]...)
+		i--
+
+		if task.reserved {
+			return task, true
+		}
+		s.queues[task.host] = append([]linkTask{task}, s.queues[task.host]...)
+	}
+	return linkTask{}, false
+}
+
+// Done releases the slot taken by a task of the host.
+func (s *linkScheduler) Done(host string) {
+	s.active[host]--
+}
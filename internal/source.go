@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Source reads links from the export file of a read-later service or browser. Sources are
+// registered with RegisterSource, and the source of an export file is chosen by sniffing its content.
+type Source interface {
+	// Name returns the unique name of the source, used to select it explicitly.
+	Name() string
+	// Detect reports whether the file at the given path, starting with the given header, is in the
+	// format read by the source. Detection should be strict enough to never match the format of another source.
+	Detect(path string, header []byte) bool
+	// Read parses the file at the given path and passes each link found to yield, stopping at the
+	// first error it returns.
+	Read(ctx context.Context, path string, yield func(Link) error) error
+}
+
+// sniffLength is the number of leading bytes of a file passed to Source.Detect.
+const sniffLength = 512
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[string]Source)
+)
+
+// RegisterSource makes a source available for detection and selection by name.
+// It panics if a source with the same name is already registered.
+func RegisterSource(source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	if _, ok := sources[source.Name()]; ok {
+		panic(fmt.Sprintf("source %s is already registered", source.Name()))
+	}
+	sources[source.Name()] = source
+}
+
+// SourceNames returns the sorted names of the registered sources.
+func SourceNames() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SourceByName returns the registered source with the given name.
+func SourceByName(name string) (Source, error) {
+	sourcesMu.RLock()
+	source, ok := sources[name]
+	sourcesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown source %s, expected one of: %s", name, strings.Join(SourceNames(), ", "))
+	}
+	return source, nil
+}
+
+// DetectSource returns the registered source able to read the file at the given path.
+func DetectSource(path string) (Source, error) {
+	header, err := readHeader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range SourceNames() {
+		source, _ := SourceByName(name)
+		if source.Detect(path, header) {
+			return source, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to detect the format of %s, expected one of: %s", path, strings.Join(SourceNames(), ", "))
+}
+
+// readHeader returns the leading bytes of the file at the given path, which may be fewer than
+// sniffLength for small files.
+func readHeader(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	return header[:n], nil
+}
+
+// firstLine returns the first line of the header, without a byte order mark or line ending.
+func firstLine(header []byte) string {
+	line := strings.TrimPrefix(string(header), "\ufeff")
+	if i := strings.IndexAny(line, "\r\n"); i >= 0 {
+		line = line[:i]
+	}
+	return line
+}
+
+// readFile opens the file at the given path and passes it to read, closing it afterwards.
+func readFile(path string, read func(r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	return read(file)
+}
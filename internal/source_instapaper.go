@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gocarina/gocsv"
+	"io"
+	"strings"
+	"time"
+)
+
+// instapaperFolderStatus maps the built-in Instapaper folders to a link status. Links in the starred
+// folder are unread favorites, and links in any other folder are unread and tagged with the name of their folder.
+var instapaperFolderStatus = map[string]string{
+	"unread":  "unread",
+	"archive": "archive",
+	"starred": "unread",
+}
+
+// instapaperRow is a row of an Instapaper CSV export.
+type instapaperRow struct {
+	URL       string `csv:"URL"`
+	Title     string `csv:"Title"`
+	Selection string `csv:"Selection"`
+	Folder    string `csv:"Folder"`
+	Timestamp int64  `csv:"Timestamp"`
+	Tags      string `csv:"Tags"`
+}
+
+func (r *instapaperRow) ToLink() Link {
+	timeAdded := time.Unix(r.Timestamp, 0)
+
+	link := Link{
+		Title:     r.Title,
+		URL:       r.URL,
+		TimeAdded: timeAdded,
+		Status:    "unread",
+		Tags:      parseInstapaperTags(r.Tags),
+	}
+	if link.Title == "" {
+		link.Title = link.URL
+	}
+
+	folder := strings.TrimSpace(r.Folder)
+	if status, ok := instapaperFolderStatus[strings.ToLower(folder)]; ok {
+		link.Status = status
+		link.Favorite = strings.EqualFold(folder, "starred")
+	} else if folder != "" {
+		link.Tags = append(link.Tags, folder)
+	}
+
+	if selection := strings.TrimSpace(r.Selection); selection != "" {
+		link.Highlights = []Highlight{{Quote: selection, CreatedAt: timeAdded}}
+	}
+
+	return link
+}
+
+// parseInstapaperTags reads the tags column of newer exports, which holds either a JSON array or a comma separated list.
+func parseInstapaperTags(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	var tags []string
+	if err := json.Unmarshal([]byte(value), &tags); err != nil {
+		tags = strings.Split(value, ",")
+	}
+
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// instapaperSource reads the CSV export of Instapaper.
+type instapaperSource struct{}
+
+func init() {
+	RegisterSource(instapaperSource{})
+}
+
+func (instapaperSource) Name() string {
+	return "instapaper"
+}
+
+func (instapaperSource) Detect(path string, header []byte) bool {
+	columns := make(map[string]bool)
+	for _, column := range strings.Split(strings.ToLower(firstLine(header)), ",") {
+		columns[strings.TrimSpace(column)] = true
+	}
+	return columns["url"] && columns["title"] && columns["selection"] && columns["folder"]
+}
+
+func (instapaperSource) Read(ctx context.Context, path string, yield func(Link) error) error {
+	return readFile(path, func(r io.Reader) error {
+		var yieldErr error
+		err := gocsv.UnmarshalToCallbackWithError(r, func(row instapaperRow) error {
+			yieldErr = yield(row.ToLink())
+			return yieldErr
+		})
+		if yieldErr != nil {
+			return yieldErr
+		}
+		if err != nil {
+			return fmt.Errorf("error unmarshalling CSV file %s: %w", path, err)
+		}
+		return nil
+	})
+}
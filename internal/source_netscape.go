@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var netscapeDoctype = []byte("<!doctype netscape-bookmark-file-1>")
+
+// netscapeSource reads the Netscape bookmark file format (bookmarks.html), exported by browsers and
+// most read-later services such as Pinboard and Raindrop. Bookmarks are listed as anchors in nested
+// definition lists, with each list preceded by a heading naming its folder.
+type netscapeSource struct{}
+
+func init() {
+	RegisterSource(netscapeSource{})
+}
+
+func (netscapeSource) Name() string {
+	return "netscape"
+}
+
+func (netscapeSource) Detect(path string, header []byte) bool {
+	return bytes.HasPrefix(bytes.ToLower(bytes.TrimSpace(header)), netscapeDoctype)
+}
+
+func (netscapeSource) Read(ctx context.Context, path string, yield func(Link) error) error {
+	return readFile(path, func(r io.Reader) error {
+		doc, err := goquery.NewDocumentFromReader(r)
+		if err != nil {
+			return fmt.Errorf("error parsing bookmarks file %s: %w", path, err)
+		}
+
+		for _, anchor := range doc.Find("dt > a[href]").EachIter() {
+			link := netscapeLink(anchor)
+			if !IsURL(link.URL) {
+				continue // Skip bookmarklets and other non web links
+			}
+			if err := yield(link); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func netscapeLink(anchor *goquery.Selection) Link {
+	link := Link{
+		URL:    strings.TrimSpace(anchor.AttrOr("href", "")),
+		Title:  strings.TrimSpace(anchor.Text()),
+		Status: "unread",
+	}
+	if link.Title == "" {
+		link.Title = link.URL
+	}
+
+	if timeAdded, err := strconv.ParseInt(anchor.AttrOr("add_date", ""), 10, 64); err == nil {
+		link.TimeAdded = time.Unix(timeAdded, 0)
+	}
+
+	if toRead := anchor.AttrOr("toread", ""); toRead == "0" {
+		link.Status = "archive"
+	}
+
+	for _, tag := range strings.Split(anchor.AttrOr("tags", ""), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			link.Tags = append(link.Tags, tag)
+		}
+	}
+	if folder := netscapeFolderPath(anchor); folder != "" {
+		link.Tags = append(link.Tags, folder)
+	}
+
+	return link
+}
+
+// netscapeFolderPath returns the path of the folder containing the bookmark, as a nested tag made of
+// the folder names joined with a slash. Bookmarks at the top level have no folder.
+func netscapeFolderPath(anchor *goquery.Selection) string {
+	folders := make([]string, 0)
+	for _, list := range anchor.ParentsFiltered("dl").EachIter() {
+		name := strings.TrimSpace(list.Parent().Filter("dt").ChildrenFiltered("h3").First().Text())
+		if name != "" {
+			folders = append([]string{strings.ReplaceAll(name, "/", "-")}, folders...)
+		}
+	}
+	return strings.Join(folders, "/")
+}
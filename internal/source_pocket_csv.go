@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocarina/gocsv"
+	"io"
+	"strings"
+)
+
+// pocketCSVSource reads the CSV files of a Pocket export, either on their own or extracted from the ZIP archive.
+type pocketCSVSource struct{}
+
+func init() {
+	RegisterSource(pocketCSVSource{})
+}
+
+func (pocketCSVSource) Name() string {
+	return "pocket-csv"
+}
+
+func (pocketCSVSource) Detect(path string, header []byte) bool {
+	columns := make(map[string]bool)
+	for _, column := range strings.Split(strings.ToLower(firstLine(header)), ",") {
+		columns[strings.TrimSpace(column)] = true
+	}
+	return columns["title"] && columns["url"] && columns["time_added"]
+}
+
+func (pocketCSVSource) Read(ctx context.Context, path string, yield func(Link) error) error {
+	return readFile(path, func(r io.Reader) error {
+		return readPocketCSV(r, path, yield)
+	})
+}
+
+// readPocketCSV reads Pocket CSV rows from the reader and passes them to yield.
+// The name is only used to give context to errors.
+func readPocketCSV(r io.Reader, name string, yield func(Link) error) error {
+	var yieldErr error
+	err := gocsv.UnmarshalToCallbackWithError(r, func(raw RawLink) error {
+		yieldErr = yield(raw.ToLink())
+		return yieldErr
+	})
+	if yieldErr != nil {
+		return yieldErr
+	}
+	if err != nil {
+		return fmt.Errorf("error unmarshalling CSV file %s: %w", name, err)
+	}
+	return nil
+}
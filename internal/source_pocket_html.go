@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// legacySectionStatus maps the headings of the lists in a legacy Pocket HTML export to a link status.
+var legacySectionStatus = map[string]string{
+	"unread":       "unread",
+	"read archive": "archive",
+}
+
+// pocketHTMLSource reads the legacy Pocket HTML export (ril_export.html), where links are listed
+// as anchors under an "Unread" and a "Read Archive" heading.
+type pocketHTMLSource struct{}
+
+func init() {
+	RegisterSource(pocketHTMLSource{})
+}
+
+func (pocketHTMLSource) Name() string {
+	return "pocket-html"
+}
+
+// Detect matches HTML documents titled Pocket Export, as the title of legacy exports is set early in their head.
+func (pocketHTMLSource) Detect(path string, header []byte) bool {
+	header = bytes.ToLower(bytes.TrimSpace(header))
+	if !bytes.HasPrefix(header, []byte("<!doctype html")) && !bytes.HasPrefix(header, []byte("<html")) {
+		return false
+	}
+	return bytes.Contains(header, []byte("<title>pocket export</title>"))
+}
+
+func (pocketHTMLSource) Read(ctx context.Context, path string, yield func(Link) error) error {
+	return readFile(path, func(r io.Reader) error {
+		doc, err := goquery.NewDocumentFromReader(r)
+		if err != nil {
+			return fmt.Errorf("error parsing HTML file %s: %w", path, err)
+		}
+
+		for _, heading := range doc.Find("h1").EachIter() {
+			status, ok := legacySectionStatus[strings.ToLower(strings.TrimSpace(heading.Text()))]
+			if !ok {
+				continue
+			}
+
+			for _, anchor := range heading.NextUntil("h1").Find("a[href]").EachIter() {
+				if err := yield(legacyLink(anchor, status)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func legacyLink(anchor *goquery.Selection, status string) Link {
+	link := Link{
+		URL:    strings.TrimSpace(anchor.AttrOr("href", "")),
+		Title:  strings.TrimSpace(anchor.Text()),
+		Status: status,
+	}
+	if link.Title == "" {
+		link.Title = link.URL
+	}
+
+	if timeAdded, err := strconv.ParseInt(anchor.AttrOr("time_added", ""), 10, 64); err == nil {
+		link.TimeAdded = time.Unix(timeAdded, 0)
+	}
+
+	for _, tag := range strings.Split(anchor.AttrOr("tags", ""), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			link.Tags = append(link.Tags, tag)
+		}
+	}
+
+	return link
+}
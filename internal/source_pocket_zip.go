@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal/logger"
+	"go.uber.org/zap"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+var zipMagic = []byte("PK\x03\x04")
+
+// pocketZipSource reads the ZIP archive of a Pocket export, made of one or more CSV parts and
+// an annotations folder with the highlights made on the articles.
+type pocketZipSource struct{}
+
+func init() {
+	RegisterSource(pocketZipSource{})
+}
+
+func (pocketZipSource) Name() string {
+	return "pocket-zip"
+}
+
+func (pocketZipSource) Detect(path string, header []byte) bool {
+	return bytes.HasPrefix(header, zipMagic)
+}
+
+// Read reads every CSV part of the archive, in order, and merges them. Links that appear in
+// more than one part are only yielded once, with any highlights found for them attached.
+func (pocketZipSource) Read(ctx context.Context, archivePath string, yield func(Link) error) error {
+	log := logger.Logger(ctx)
+
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("error opening archive %s: %w", archivePath, err)
+	}
+	defer func(archive *zip.ReadCloser) {
+		_ = archive.Close()
+	}(archive)
+
+	parts := make([]*zip.File, 0)
+	annotationParts := make([]*zip.File, 0)
+	for _, file := range archive.File {
+		if isExportPart(file) {
+			parts = append(parts, file)
+		} else if isAnnotationsPart(file) {
+			annotationParts = append(annotationParts, file)
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("no CSV files found in archive %s", archivePath)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Name < parts[j].Name
+	})
+
+	highlights := make(map[string][]Highlight)
+	for _, part := range annotationParts {
+		log.Debug("Importing annotations from archive part", zap.String("archive", archivePath), zap.String("part", part.Name))
+
+		err := readArchivePart(part, archivePath, func(r io.Reader, name string) error {
+			found, err := readAnnotations(r, name)
+			for url, h := range found {
+				highlights[url] = append(highlights[url], h...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range parts {
+		log.Debug("Importing links from archive part", zap.String("archive", archivePath), zap.String("part", part.Name))
+
+		err := readArchivePart(part, archivePath, func(r io.Reader, name string) error {
+			return readPocketCSV(r, name, func(link Link) error {
+				if seen[link.URL] {
+					return nil
+				}
+				seen[link.URL] = true
+				link.Highlights = highlights[link.URL]
+				return yield(link)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readArchivePart opens the archive entry and passes it to read, along with a name for it to use in errors.
+func readArchivePart(part *zip.File, archivePath string, read func(r io.Reader, name string) error) error {
+	reader, err := part.Open()
+	if err != nil {
+		return fmt.Errorf("error opening %s in archive %s: %w", part.Name, archivePath, err)
+	}
+	defer func(reader io.ReadCloser) {
+		_ = reader.Close()
+	}(reader)
+
+	return read(reader, fmt.Sprintf("%s:%s", archivePath, part.Name))
+}
+
+// isExportPart reports whether the archive entry is one of the CSV parts of the export,
+// skipping directories, the annotations folder and any metadata added by archivers.
+func isExportPart(file *zip.File) bool {
+	if file.FileInfo().IsDir() {
+		return false
+	}
+	name := file.Name
+	if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+		return false
+	}
+	if strings.HasPrefix(name, "annotations/") {
+		return false
+	}
+	return strings.EqualFold(path.Ext(name), ".csv")
+}
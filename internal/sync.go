@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal/logger"
+	"go.uber.org/zap"
+)
+
+// SyncReport summarises the sync of an export file with the notes already in the vault.
+type SyncReport struct {
+	// Added is the number of new links whose note was written.
+	Added int
+	// Updated is the number of existing notes whose properties were updated.
+	Updated int
+	// Unchanged is the number of existing notes that were already up to date.
+	Unchanged int
+	// Results holds the result of each new link visited and of each existing note that could not be updated.
+	Results []CrawlResult
+}
+
+// SyncLinks reads the links of the export file using the given source, or the source detected from the
+// file content when nil, and brings the vault up to date with them. Links without a note, matched by the
+// source URL in the frontmatter of the notes, are visited to write one, while the properties of the
+// existing notes are updated without visiting their link again.
+func (c *PocketCrawler) SyncLinks(ctx context.Context, source Source, linksFile string) (*SyncReport, error) {
+	log := logger.Logger(ctx)
+
+	links, err := c.loadLinks(ctx, source, linksFile)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := ScanVault(ctx, c.writer.baseFolder)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Found notes in vault", zap.Int("count", len(notes)))
+	c.writer.IndexNotes(notes)
+
+	report := &SyncReport{}
+	newLinks := make([]Link, 0)
+	seen := make(map[string]bool)
+	for _, link := range links.Links {
+		if seen[link.URL] {
+			continue
+		}
+		seen[link.URL] = true
+
+		note, ok := notes[link.URL]
+		if !ok {
+			newLinks = append(newLinks, link)
+			continue
+		}
+
+		updated, err := c.writer.UpdateNote(note, link)
+		if err != nil {
+			log.Error("Error updating note", zap.String("url", link.URL), zap.String("fileName", note.Path), zap.Error(err))
+			report.Results = append(report.Results, newCrawlResult(link, 0, fmt.Errorf("%w: %w", ErrWrite, err)))
+			continue
+		}
+		if updated {
+			log.Debug("Updated note", zap.String("url", link.URL), zap.String("fileName", note.Path))
+			report.Updated++
+		} else {
+			report.Unchanged++
+		}
+	}
+
+	log.Debug("Found new links", zap.Int("count", len(newLinks)))
+
+	for _, result := range c.crawl(ctx, newLinks) {
+		if result.Success {
+			report.Added++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// TagMapping changes the tags of the links before they are written to the notes. Tags are matched by their
+// normalized form, so a mapping for "Machine Learning" also applies to "machine-learning".
+type TagMapping struct {
+	// Rename replaces a tag with another one.
+	Rename map[string]string `yaml:"rename"`
+	// Merge replaces each of the listed tags with the tag they are listed under.
+	Merge map[string][]string `yaml:"merge"`
+	// Drop removes tags from the notes.
+	Drop []string `yaml:"drop"`
+	// Prefix is added to every tag of the links, such as pocket/ to nest them under a pocket tag.
+	Prefix string `yaml:"prefix"`
+
+	renames map[string]string
+	dropped map[string]bool
+}
+
+// ReadTagMapping reads the tag mapping from the YAML file at the given path.
+func ReadTagMapping(path string) (*TagMapping, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tag mapping %s: %w", path, err)
+	}
+
+	mapping := &TagMapping{}
+	if err := yaml.Unmarshal(content, mapping); err != nil {
+		return nil, fmt.Errorf("error parsing tag mapping %s: %w", path, err)
+	}
+
+	mapping.renames = make(map[string]string)
+	for from, to := range mapping.Rename {
+		mapping.renames[NormalizeTag(from)] = to
+	}
+	for to, tags := range mapping.Merge {
+		for _, from := range tags {
+			mapping.renames[NormalizeTag(from)] = to
+		}
+	}
+	mapping.dropped = make(map[string]bool)
+	for _, tag := range mapping.Drop {
+		mapping.dropped[NormalizeTag(tag)] = true
+	}
+
+	return mapping, nil
+}
+
+// Apply returns the tags normalized for Obsidian, after dropping and renaming them and adding the prefix.
+// Tags that end up the same are only kept once. A nil mapping only normalizes the tags.
+func (m *TagMapping) Apply(tags []string) []string {
+	var mapped []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if m != nil {
+			if m.dropped[tag] {
+				continue
+			}
+			if to, ok := m.renames[tag]; ok {
+				tag = NormalizeTag(to)
+			}
+			if tag != "" {
+				tag = NormalizeTag(m.Prefix + tag)
+			}
+		}
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		mapped = append(mapped, tag)
+	}
+	return mapped
+}
+
+// NormalizeTag returns the tag following the rules of Obsidian tags, in lower kebab case. Slashes separate
+// nested tags, other characters than letters, digits and underscores become dashes, and tags made only of
+// digits, which Obsidian does not accept, get an underscore prefix.
+func NormalizeTag(tag string) string {
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimLeft(strings.TrimSpace(tag), "#"), "/") {
+		if segment = normalizeTagSegment(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	normalized := strings.Join(segments, "/")
+	if strings.IndexFunc(normalized, func(r rune) bool { return !unicode.IsDigit(r) && r != '/' }) < 0 && normalized != "" {
+		normalized = "_" + normalized
+	}
+	return normalized
+}
+
+// normalizeTagSegment returns a level of a nested tag in lower case, with runs of characters other than
+// letters, digits and underscores replaced by a single dash.
+func normalizeTagSegment(segment string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range segment {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			if dash && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	return sb.String()
+}
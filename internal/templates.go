@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"html"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.md.tmpl
+var builtinTemplates embed.FS
+
+// NoteData is the data available to the frontmatter and body templates of the notes.
+type NoteData struct {
+	// Link is the link the note is written for, with the meta tags found on its page.
+	Link Link
+	// Title is the title of the article.
+	Title string
+	// URL is the URL of the article.
+	URL string
+	// Domain is the domain of the URL of the article, without any www prefix.
+	Domain string
+	// Author is the author of the article, or unknown.
+	Author string
+	// Description is the description of the article, or none.
+	Description string
+	// Published is the date the article was published, if known.
+	Published time.Time
+	// Created is the date the link was added.
+	Created time.Time
+	// Tags are the tags of the note, including the clippings and pocket tags.
+	Tags []string
+	// Status is the status of the link, such as unread or archive.
+	Status string
+	// Read reports whether the link was archived.
+	Read bool
+	// Favorite reports whether the link was marked as a favorite.
+	Favorite bool
+	// Meta holds the meta tags found on the page of the article, keyed by name or property.
+	Meta map[string]string
+	// Highlights are the passages highlighted on the article.
+	Highlights []Highlight
+	// Content is the article converted to Markdown.
+	Content string
+	// Frontmatter holds the properties of the note written by the built-in frontmatter template.
+	Frontmatter Frontmatter
+}
+
+// newNoteData returns the data of the note of the link with the given content.
+func newNoteData(link Link, content string) NoteData {
+	return NoteData{
+		Link:        link,
+		Title:       link.TitleValue(),
+		URL:         link.URL,
+		Domain:      strings.TrimPrefix(hostOf(link.URL), "www."),
+		Author:      link.Author(),
+		Description: strings.TrimSpace(link.Description()),
+		Published:   link.PublishedTime(),
+		Created:     link.TimeAdded,
+		Tags:        noteTags(link),
+		Status:      link.Status,
+		Read:        link.Read(),
+		Favorite:    link.Favorite,
+		Meta:        link.Meta,
+		Highlights:  link.Highlights,
+		Content:     content,
+		Frontmatter: newFrontmatter(link),
+	}
+}
+
+// NoteTemplates render the notes. The frontmatter template renders the YAML properties of a note, without
+// the delimiters, and the body template renders the content clipped from the article.
+type NoteTemplates struct {
+	frontmatter *template.Template
+	body        *template.Template
+}
+
+// ParseNoteTemplates reads the frontmatter and body templates from the given files, using the built-in
+// template for any file not set. Besides the built-in functions of text/template, templates can use:
+//
+//   - yaml, to write a value as YAML, such as the properties of the built-in template with yaml .Frontmatter
+//   - quote, to write a value as a YAML double-quoted string
+//   - date, to format a time as a date, or with the layout given as second argument
+//   - highlights, to render highlights as Obsidian callouts
+//   - join, lower, slug and unescape, to format values
+func ParseNoteTemplates(frontmatterFile string, bodyFile string) (*NoteTemplates, error) {
+	frontmatter, err := parseNoteTemplate("frontmatter", frontmatterFile)
+	if err != nil {
+		return nil, err
+	}
+	body, err := parseNoteTemplate("body", bodyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &NoteTemplates{frontmatter: frontmatter, body: body}, nil
+}
+
+func parseNoteTemplate(name string, file string) (*template.Template, error) {
+	var text []byte
+	var err error
+	if file == "" {
+		text, err = builtinTemplates.ReadFile(fmt.Sprintf("templates/%s.md.tmpl", name))
+	} else {
+		text, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s template: %w", name, err)
+	}
+
+	t, err := template.New(name).
+		Option("missingkey=zero").
+		Funcs(noteTemplateFuncs).
+		Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s template %s: %w", name, file, err)
+	}
+
+	// Catch references to unknown fields before any note is written
+	if err := t.Execute(&bytes.Buffer{}, NoteData{}); err != nil {
+		return nil, fmt.Errorf("error parsing %s template %s: %w", name, file, err)
+	}
+
+	return t, nil
+}
+
+var noteTemplateFuncs = template.FuncMap{
+	"yaml":       encodeYAML,
+	"quote":      quoteYAML,
+	"date":       formatDate,
+	"highlights": renderHighlights,
+	"join":       strings.Join,
+	"lower":      strings.ToLower,
+	"slug":       Slugify,
+	"unescape":   html.UnescapeString,
+}
+
+// quoteYAML returns the value as a YAML double-quoted string, escaping any character that needs it.
+func quoteYAML(value any) (string, error) {
+	quoted, err := encodeYAML(fmt.Sprint(value))
+	return strings.TrimSuffix(quoted, "\n"), err
+}
+
+// formatDate formats the time as a date, or with the given layout.
+func formatDate(t time.Time, layout ...string) string {
+	if len(layout) > 0 {
+		return t.Format(layout[0])
+	}
+	return t.Format("2006-01-02")
+}
+
+// Render returns the note of the link with the given content, made of its frontmatter and its clipped block.
+// It fails when the frontmatter template does not render a valid YAML mapping.
+func (t *NoteTemplates) Render(link Link, content string) (string, error) {
+	data := newNoteData(link, content)
+
+	frontmatter, _, err := t.renderFrontmatter(data)
+	if err != nil {
+		return "", err
+	}
+
+	var body bytes.Buffer
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", fmt.Errorf("error rendering body template: %w", err)
+	}
+
+	var note strings.Builder
+	note.WriteString(frontmatterDelimiter + "\n")
+	note.WriteString(strings.TrimRight(frontmatter, "\n"))
+	note.WriteString("\n" + frontmatterDelimiter + "\n\n")
+	note.WriteString(clippedBlock(body.String()))
+	return note.String(), nil
+}
+
+// renderFrontmatter renders the frontmatter template for the data, and returns it along with the mapping
+// of the properties it holds. It fails when the template does not render a valid YAML mapping.
+func (t *NoteTemplates) renderFrontmatter(data NoteData) (string, *yaml.Node, error) {
+	var frontmatter bytes.Buffer
+	if err := t.frontmatter.Execute(&frontmatter, data); err != nil {
+		return "", nil, fmt.Errorf("error rendering frontmatter template: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(frontmatter.Bytes(), &doc); err != nil {
+		return "", nil, fmt.Errorf("frontmatter template rendered invalid YAML for %s: %w", data.URL, err)
+	}
+	properties := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		if doc.Content[0].Kind != yaml.MappingNode {
+			return "", nil, fmt.Errorf("frontmatter template rendered invalid YAML for %s: not a mapping", data.URL)
+		}
+		properties = doc.Content[0]
+	}
+	return frontmatter.String(), properties, nil
+}
+
+// SyncedProperties returns the properties of the note of the link that change between two exports of the
+// link: those the frontmatter template renders from the status, favorite flag and tags of the link. They
+// are found by rendering the template a second time for the link with another status, favorite flag and
+// tags, and keeping the properties whose value differs.
+func (t *NoteTemplates) SyncedProperties(link Link) (*yaml.Node, error) {
+	_, properties, err := t.renderFrontmatter(newNoteData(link, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	probe := link
+	probe.Status = "archive"
+	if link.Read() {
+		probe.Status = "unread"
+	}
+	probe.Favorite = !link.Favorite
+	probe.Tags = append(slices.Clone(link.Tags), "pocket-obsidian-migrator-probe")
+	_, probeProperties, err := t.renderFrontmatter(newNoteData(probe, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	synced := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(properties.Content); i += 2 {
+		key, value := properties.Content[i], properties.Content[i+1]
+		if probeValue, ok := mappingValue(probeProperties, key.Value); ok && sameYAML(value, probeValue) {
+			continue
+		}
+		synced.Content = append(synced.Content, key, value)
+	}
+	return synced, nil
+}
+
+// mappingValue returns the value of the given key of the mapping.
+func mappingValue(mapping *yaml.Node, key string) (*yaml.Node, bool) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1], true
+		}
+	}
+	return nil, false
+}
+
+// sameYAML reports whether the two nodes hold the same value, whatever their style.
+func sameYAML(a *yaml.Node, b *yaml.Node) bool {
+	var aValue, bValue any
+	if err := a.Decode(&aValue); err != nil {
+		return false
+	}
+	if err := b.Decode(&bValue); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(aValue, bValue)
+}
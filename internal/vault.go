@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/adrian-mcmichael/pocket-obsidian-migrator/internal/logger"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const frontmatterDelimiter = "---"
+
+// Note is a Markdown file of the vault, split into its YAML frontmatter and its body.
+type Note struct {
+	Path        string
+	Frontmatter *yaml.Node
+	Body        string
+}
+
+// ReadNote reads the Markdown file at the given path. Files without frontmatter get an empty one.
+func ReadNote(path string) (*Note, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+
+	return parseNote(path, string(content))
+}
+
+// parseNote parses the content of the Markdown file at the given path.
+func parseNote(path string, content string) (*Note, error) {
+	note := &Note{
+		Path:        path,
+		Frontmatter: &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"},
+		Body:        content,
+	}
+
+	frontmatter, body, ok := splitFrontmatter(content)
+	if !ok {
+		return note, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(frontmatter), &doc); err != nil {
+		return nil, fmt.Errorf("error parsing frontmatter of %s: %w", path, err)
+	}
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		note.Frontmatter = doc.Content[0]
+	}
+	note.Body = body
+
+	return note, nil
+}
+
+// splitFrontmatter splits the content of a note into its frontmatter, without delimiters, and its body.
+func splitFrontmatter(content string) (string, string, bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(content, frontmatterDelimiter+"\n") && !strings.HasPrefix(content, frontmatterDelimiter+"\r\n") {
+		return "", content, false
+	}
+
+	rest := content[strings.Index(content, "\n")+1:]
+	offset := 0
+	for {
+		end := strings.Index(rest[offset:], "\n")
+		line := rest[offset:]
+		if end >= 0 {
+			line = rest[offset : offset+end]
+		}
+		if strings.TrimRight(line, "\r ") == frontmatterDelimiter {
+			if end < 0 {
+				return rest[:offset], "", true
+			}
+			return rest[:offset], rest[offset+end+1:], true
+		}
+		if end < 0 {
+			return "", content, false
+		}
+		offset += end + 1
+	}
+}
+
+// Property returns the value of the frontmatter property with the given key.
+func (n *Note) Property(key string) (*yaml.Node, bool) {
+	return mappingValue(n.Frontmatter, key)
+}
+
+// Source returns the URL of the article the note was clipped from.
+func (n *Note) Source() string {
+	if value, ok := n.Property("source"); ok && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+// SetProperty sets the frontmatter property with the given key to the value, adding it when missing.
+// It reports whether the frontmatter changed, leaving properties that already hold the value untouched.
+func (n *Note) SetProperty(key string, node *yaml.Node) bool {
+	existing, ok := n.Property(key)
+	if ok && sameYAML(existing, node) {
+		return false
+	}
+
+	if ok {
+		*existing = *node
+	} else {
+		n.Frontmatter.Content = append(n.Frontmatter.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			node,
+		)
+	}
+	return true
+}
+
+// MergeFrontmatter sets the properties of the given frontmatter on the note, replacing the values of
+// the properties it already has and keeping the others.
+func (n *Note) MergeFrontmatter(frontmatter *yaml.Node) {
+	for i := 0; i+1 < len(frontmatter.Content); i += 2 {
+		key, value := frontmatter.Content[i], frontmatter.Content[i+1]
+		if existing, ok := n.Property(key.Value); ok {
+			*existing = *value
+		} else {
+			n.Frontmatter.Content = append(n.Frontmatter.Content, key, value)
+		}
+	}
+}
+
+// quoteStrings double quotes the string scalars of the node, the way the writer quotes them.
+// The keys of mappings are left unquoted.
+func quoteStrings(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		quoteStrings(child)
+	}
+}
+
+// Save writes the note back to its file.
+func (n *Note) Save() error {
+	var buf bytes.Buffer
+	buf.WriteString(frontmatterDelimiter + "\n")
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(n.Frontmatter); err != nil {
+		return fmt.Errorf("error encoding frontmatter of %s: %w", n.Path, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("error encoding frontmatter of %s: %w", n.Path, err)
+	}
+
+	buf.WriteString(frontmatterDelimiter + "\n")
+	buf.WriteString(n.Body)
+
+	if err := os.WriteFile(n.Path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("error writing file %s: %w", n.Path, err)
+	}
+	return nil
+}
+
+// ScanVault reads the notes under the given folder and returns them keyed by the URL of their source.
+// Hidden folders, such as the one holding the journal or the Obsidian settings, and notes without a source are skipped.
+// Notes that cannot be read or whose frontmatter is not valid YAML, such as notes written by hand, are logged and skipped.
+func ScanVault(ctx context.Context, baseFolder string) (map[string]*Note, error) {
+	log := logger.Logger(ctx)
+
+	absPath, err := filepath.Abs(baseFolder)
+	if err != nil {
+		return nil, fmt.Errorf("error getting absolute path for %s: %w", baseFolder, err)
+	}
+
+	notes := make(map[string]*Note)
+	err = filepath.WalkDir(absPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == absPath {
+				if errors.Is(err, fs.ErrNotExist) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			log.Warn("Error reading vault folder, skipping it", zap.String("path", path), zap.Error(err))
+			return nil
+		}
+		if entry.IsDir() {
+			if path != absPath && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+
+		note, err := ReadNote(path)
+		if err != nil {
+			log.Warn("Error reading note, skipping it", zap.String("fileName", path), zap.Error(err))
+			return nil
+		}
+		if source := note.Source(); source != "" {
+			notes[source] = note
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning vault %s: %w", absPath, err)
+	}
+
+	return notes, nil
+}
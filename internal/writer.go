@@ -1,16 +1,30 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/gocarina/gocsv"
-	"github.com/gocolly/colly"
+	"gopkg.in/yaml.v3"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 type MarkdownWriter struct {
-	baseFolder string
+	baseFolder   string
+	onConflict   ConflictStrategy
+	pathTemplate *PathTemplate
+	templates    *NoteTemplates
+	tagMapping   *TagMapping
+	attachments  *AttachmentStore
+
+	mu     sync.Mutex
+	claims map[string]string
+	// notes maps the URLs of the links to the paths of their notes found in the vault before the import.
+	notes map[string]string
 }
 
 // NewMarkdownWriter initializes a new MarkdownWriter with the given file path.
@@ -30,103 +44,271 @@ func NewMarkdownWriter(baseFolder string) (*MarkdownWriter, error) {
 		return nil, fmt.Errorf("error getting absolute path for %s: %w", baseFolder, err)
 	}
 
-	// Ensure the clippings folder exists
-	clippingsPath := fmt.Sprintf("%s/clippings", absPath)
-	if err := os.MkdirAll(clippingsPath, os.ModePerm); err != nil {
+	// Ensure the base folder exists, the folders of the notes are created as they are written
+	if err := os.MkdirAll(absPath, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("error creating base folder %s: %v\n", baseFolder, err)
 	}
 
+	pathTemplate, err := ParsePathTemplate(DefaultPathTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := ParseNoteTemplates("", "")
+	if err != nil {
+		return nil, err
+	}
+
 	return &MarkdownWriter{
-		baseFolder: absPath,
+		baseFolder:   absPath,
+		onConflict:   ConflictMerge,
+		pathTemplate: pathTemplate,
+		templates:    templates,
+		claims:       make(map[string]string),
+		notes:        make(map[string]string),
 	}, nil
 }
 
-// WriteMarkdownFile writes a new file based on the given Link and its content.
+// WriteMarkdownFile writes a new file based on the given Link and its content. When a note already exists
+// at the path of the file, it is handled according to the conflict strategy of the writer.
 func (w *MarkdownWriter) WriteMarkdownFile(link Link, content string) (string, error) {
-	markdownFileName := colly.SanitizeFileName(fmt.Sprintf("%s.md", link.TitleValue()))
-	fileName := fmt.Sprintf("%s/clippings/%s", w.baseFolder, markdownFileName)
+	link.Tags = w.tagMapping.Apply(link.Tags)
 
-	file, err := os.Create(fileName)
+	fileName, err := w.claimFileName(link)
 	if err != nil {
-		return fileName, fmt.Errorf("error creating file %s: %w", w.baseFolder, err)
+		return fileName, err
+	}
+	if err := w.moveIndexedNote(link.URL, fileName); err != nil {
+		return fileName, err
 	}
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
 
-	// Write file header
-	err = w.writeFileHeader(link, file)
+	note, err := w.templates.Render(link, w.attachments.LinkImages(content, fileName))
 	if err != nil {
 		return fileName, err
 	}
 
-	// Write the content to the file
-	_, err = file.WriteString(content)
-	if err != nil {
-		return fileName, fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+	if _, err := os.Stat(fileName); err == nil {
+		switch w.onConflict {
+		case ConflictSkip:
+			return fileName, ErrNoteExists
+		case ConflictMerge:
+			return fileName, w.mergeNote(fileName, note)
+		case ConflictRename:
+			fileName = availableFileName(fileName)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return fileName, fmt.Errorf("error creating folder %s: %w", filepath.Dir(fileName), err)
+	}
+	if err := os.WriteFile(fileName, []byte(note), 0o644); err != nil {
+		return fileName, fmt.Errorf("error writing to file %s: %w", fileName, err)
 	}
 
 	return fileName, nil
 }
 
-func (w *MarkdownWriter) writeFileHeader(link Link, file *os.File) error {
-	_, err := file.WriteString("---\n")
-	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+// IndexNotes records the paths of the notes of the vault, keyed by the URL of their source, so the notes
+// of links whose path changed since they were written, such as when their status changed with status
+// folders, are moved to their new path rather than written again.
+func (w *MarkdownWriter) IndexNotes(notes map[string]*Note) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for source, note := range notes {
+		w.notes[source] = note.Path
 	}
+}
 
-	_, err = file.WriteString(fmt.Sprintf("title: \"%s\"\n", link.TitleValue()))
-	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+// moveIndexedNote moves the note of the link found in the vault to the given path, when it is elsewhere
+// and no note is at the path yet, so it is merged with the note written for the link.
+func (w *MarkdownWriter) moveIndexedNote(url string, fileName string) error {
+	w.mu.Lock()
+	previous, ok := w.notes[url]
+	w.notes[url] = fileName
+	w.mu.Unlock()
+
+	if !ok || previous == fileName {
+		return nil
 	}
-	_, err = file.WriteString(fmt.Sprintf("source: \"%s\"\n", link.URL))
-	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+	if _, err := os.Stat(fileName); err == nil {
+		return nil
 	}
-	_, err = file.WriteString(fmt.Sprintf("author: \n  - \"%s\"\n", link.Author()))
-	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+	if _, err := os.Stat(previous); err != nil {
+		return nil
 	}
-	if !link.PublishedTime().IsZero() {
-		_, err = file.WriteString(fmt.Sprintf("published: %s\n", link.PublishedTime().Format("2006-01-02")))
-		if err != nil {
-			return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
-		}
+	return moveFile(previous, fileName)
+}
+
+// relocateNote moves the note to the path rendered for the link, when it changed since the note was
+// written. It reports whether the note was moved.
+func (w *MarkdownWriter) relocateNote(note *Note, link Link) (bool, error) {
+	// The page of the link is not visited again, the note is named after the title it was written with
+	if title, ok := note.Property("title"); ok && title.Kind == yaml.ScalarNode && title.Value != "" {
+		link.Meta = map[string]string{"title": title.Value}
 	}
-	_, err = file.WriteString(fmt.Sprintf("created: %s\n", link.TimeAdded.Format("2006-01-02")))
+
+	fileName, err := w.claimFileName(link)
 	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+		return false, err
+	}
+	if fileName == note.Path {
+		return false, nil
 	}
-	if link.Description() != "" {
-		escapedDescription := strings.TrimSpace(strings.Replace(link.Description(), `"`, `\"`, -1))
-		_, err = file.WriteString(fmt.Sprintf("description: \"%s\"\n", escapedDescription))
+	// Another note of the link is already at the path
+	if _, err := os.Stat(fileName); err == nil {
+		return false, nil
+	}
+
+	if err := moveFile(note.Path, fileName); err != nil {
+		return false, err
+	}
+	note.Path = fileName
+	return true, nil
+}
+
+// moveFile moves the file to the given path, creating its folder when needed and removing its previous
+// folder when left empty.
+func moveFile(from string, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating folder %s: %w", filepath.Dir(to), err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("error moving file %s to %s: %w", from, to, err)
+	}
+	_ = os.Remove(filepath.Dir(from)) // Fails when the folder holds other files
+	return nil
+}
+
+// claimFileName returns the path of the note of the link and reserves it for the link for the rest of
+// the import. The path is rendered from the path template, with the domain of the link and then a short
+// hash of its URL added to the file name when another link, or a note clipped from another link, already has it.
+func (w *MarkdownWriter) claimFileName(link Link) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	domain := strings.TrimPrefix(hostOf(link.URL), "www.")
+	hash := sha256.Sum256([]byte(link.URL))
+	disambiguators := []string{
+		"",
+		domain,
+		fmt.Sprintf("%s %s", domain, hex.EncodeToString(hash[:])[:8]),
+	}
+
+	var fileName string
+	for _, disambiguator := range disambiguators {
+		notePath, err := w.pathTemplate.Render(newPathData(link), disambiguator)
 		if err != nil {
-			return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+			return "", err
+		}
+
+		fileName = filepath.Join(w.baseFolder, filepath.FromSlash(notePath))
+		if w.isAvailable(fileName, link.URL) {
+			w.claims[fileName] = link.URL
+			return fileName, nil
 		}
 	}
-	_, err = file.WriteString("tags:\n")
-	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+
+	// The short hashes of the URLs of two links are the same, fall back to numbering the notes
+	for i := 1; ; i++ {
+		candidate := numberedFileName(fileName, i)
+		if w.isAvailable(candidate, link.URL) {
+			w.claims[candidate] = link.URL
+			return candidate, nil
+		}
+	}
+}
+
+// isAvailable reports whether the note of the link can be written at the given path, because no other
+// link claimed it and no note exists there or the note there was clipped from the same link.
+// The caller must hold the lock.
+func (w *MarkdownWriter) isAvailable(fileName string, url string) bool {
+	if claimedBy, ok := w.claims[fileName]; ok {
+		return claimedBy == url
+	}
+
+	note, err := ReadNote(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	return err == nil && note.Source() == url
+}
+
+// RelativePath returns the path of the file relative to the base folder of the writer.
+func (w *MarkdownWriter) RelativePath(fileName string) string {
+	if rel, err := filepath.Rel(w.baseFolder, fileName); err == nil {
+		return rel
 	}
-	_, err = file.WriteString(fmt.Sprintf("  - \"clippings\"\n"))
+	return fileName
+}
+
+// mergeNote updates the existing note at the given path with the generated note, keeping the changes
+// made to it outside of the clipped block. The properties of the generated note replace those of the
+// existing note, while other properties are kept.
+func (w *MarkdownWriter) mergeNote(fileName string, generated string) error {
+	existing, err := ReadNote(fileName)
 	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+		return err
 	}
-	_, err = file.WriteString(fmt.Sprintf("  - \"pocket\"\n"))
+	note, err := parseNote(fileName, generated)
 	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+		return err
 	}
-	for _, tag := range link.Tags {
-		_, err = file.WriteString(fmt.Sprintf("  - \"%s\"\n", tag))
-		if err != nil {
-			return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+
+	existing.MergeFrontmatter(note.Frontmatter)
+	existing.Body = replaceClippedBlock(existing.Body, note.Body)
+
+	return existing.Save()
+}
+
+// availableFileName returns the first path, made by adding a counter to the given one, at which no file exists.
+func availableFileName(fileName string) string {
+	for i := 1; ; i++ {
+		candidate := numberedFileName(fileName, i)
+		if _, err := os.Stat(candidate); errors.Is(err, os.ErrNotExist) {
+			return candidate
 		}
 	}
-	_, err = file.WriteString("---\n\n")
+}
+
+// numberedFileName returns the path made by adding the counter to the name of the given file.
+func numberedFileName(fileName string, i int) string {
+	ext := filepath.Ext(fileName)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(fileName, ext), i, ext)
+}
+
+// noteTags returns the tags of the note of the link.
+func noteTags(link Link) []string {
+	return append([]string{"clippings", "pocket"}, link.Tags...)
+}
+
+// UpdateNote updates the properties of an existing note that may change between two exports of the
+// link, those the frontmatter template renders from its status, favorite flag and tags, and saves it.
+// The note is moved when its path depends on these too, such as with status folders. It reports whether
+// the note was changed.
+func (w *MarkdownWriter) UpdateNote(note *Note, link Link) (bool, error) {
+	link.Tags = w.tagMapping.Apply(link.Tags)
+
+	properties, err := w.templates.SyncedProperties(link)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for i := 0; i+1 < len(properties.Content); i += 2 {
+		quoteStrings(properties.Content[i+1])
+		changed = note.SetProperty(properties.Content[i].Value, properties.Content[i+1]) || changed
+	}
+
+	moved, err := w.relocateNote(note, link)
 	if err != nil {
-		return fmt.Errorf("error writing to file %s: %w", w.baseFolder, err)
+		return false, err
 	}
-	return nil
+	if !changed {
+		return moved, nil
+	}
+
+	return true, note.Save()
 }
 
 type ResultsWriter struct {
@@ -166,9 +348,11 @@ func (w *ResultsWriter) WriteResults(results []CrawlResult) error {
 	}(file)
 
 	failureCount := 0
+	statusCounts := make(map[ResultStatus]int)
 	for _, result := range results {
 		if !result.Success {
 			failureCount++
+			statusCounts[result.Status]++
 		}
 	}
 	successCount := len(results) - failureCount
@@ -176,6 +360,11 @@ func (w *ResultsWriter) WriteResults(results []CrawlResult) error {
 	fmt.Println("Total URLs Crawled:", len(results))
 	fmt.Println("Successful URLs:", successCount)
 	fmt.Println("Failed URLs:", failureCount)
+	for _, status := range []ResultStatus{ResultFailed, ResultTimeout, ResultNoContent, ResultConversionError, ResultWriteError, ResultCanceled} {
+		if count := statusCounts[status]; count > 0 {
+			fmt.Printf("  %s: %d\n", status, count)
+		}
+	}
 
 	failed := make([]CrawlResult, 0, failureCount)
 	for _, result := range results {
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMarkdownFileKeepsNotesOfOtherLinks(t *testing.T) {
+	folder := t.TempDir()
+	pathTemplate, err := ParsePathTemplate("clippings/{{.Domain}}.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each import runs with a new writer, which only knows about the notes of previous imports from the vault
+	write := func(link Link) string {
+		w, err := NewMarkdownWriter(folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.pathTemplate = pathTemplate
+
+		fileName, err := w.WriteMarkdownFile(link, "content of "+link.URL)
+		if err != nil {
+			t.Fatalf("error writing note of %s: %v", link.URL, err)
+		}
+		return fileName
+	}
+
+	first := write(Link{URL: "https://example.com/a", Title: "A", TimeAdded: time.Now()})
+	second := write(Link{URL: "https://example.com/b", Title: "B", TimeAdded: time.Now()})
+	if first == second {
+		t.Fatalf("notes of different links written to the same file %s", first)
+	}
+	if again := write(Link{URL: "https://example.com/b", Title: "B", TimeAdded: time.Now()}); again != second {
+		t.Errorf("note of a link written again to %s, want %s", again, second)
+	}
+
+	for fileName, url := range map[string]string{first: "https://example.com/a", second: "https://example.com/b"} {
+		note, err := ReadNote(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source := note.Source(); source != url {
+			t.Errorf("note %s has source %s, want %s", fileName, source, url)
+		}
+	}
+}
+
+func TestWriteMarkdownFileDisambiguatesLongTitles(t *testing.T) {
+	w, err := NewMarkdownWriter(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	title := strings.Repeat("A very long title ", 12)
+	want := []string{"", " other.com", " other.com "}
+	for i, url := range []string{"https://example.com/a", "https://other.com/b", "https://other.com/c"} {
+		fileName, err := w.WriteMarkdownFile(Link{URL: url, Title: title, TimeAdded: time.Now()}, "content")
+		if err != nil {
+			t.Fatalf("error writing note of %s: %v", url, err)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(fileName), ".md")
+		if len(name) > maxSegmentLength {
+			t.Errorf("note of %s named %q, longer than %d bytes", url, name, maxSegmentLength)
+		}
+		if want[i] == "" && strings.Contains(name, " ") {
+			t.Errorf("note of %s named %q, want no disambiguator", url, name)
+		} else if want[i] != "" && !strings.Contains(name, want[i]) {
+			t.Errorf("note of %s named %q, want it to contain %q", url, name, want[i])
+		}
+	}
+}
+
+func TestWriteMarkdownFileMovesNotesOfLinksWhosePathChanged(t *testing.T) {
+	folder := t.TempDir()
+	pathTemplate, err := ParsePathTemplate(StatusPathTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(link Link) string {
+		w, err := NewMarkdownWriter(folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.pathTemplate = pathTemplate
+		notes, err := ScanVault(context.Background(), folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.IndexNotes(notes)
+
+		fileName, err := w.WriteMarkdownFile(link, "content")
+		if err != nil {
+			t.Fatalf("error writing note of %s: %v", link.URL, err)
+		}
+		return fileName
+	}
+
+	link := Link{URL: "https://example.com/a", Title: "A", Status: "unread", TimeAdded: time.Now()}
+	unread := write(link)
+	note, err := os.ReadFile(unread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(unread, append(note, "\nMy notes\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	link.Status = "archive"
+	archived := write(link)
+	if archived == unread {
+		t.Fatalf("note of archived link written to %s, want it in the archive folder", archived)
+	}
+	if _, err := os.Stat(unread); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("note left at %s after its link was archived", unread)
+	}
+	note, err = os.ReadFile(archived)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(note), "My notes") || !strings.Contains(string(note), `status: "archive"`) {
+		t.Errorf("note of archived link lost its edits or was not updated:\n%s", note)
+	}
+}